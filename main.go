@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"reflect"
+	"strings"
+	"syscall"
 	"time"
 
 	"sync"
@@ -12,6 +19,8 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/gosuri/uiprogress"
 	"github.com/livesense-inc/split_mysql/splmysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -26,8 +35,19 @@ var globalFlags = []cli.Flag{
 	cliDryRun,
 	cliParallel,
 	cliMaxRetry,
+	cliRetryBackoff,
+	cliMaxRetryBackoff,
 	cliShuffle,
+	cliDescending,
+	cliAllowSplitColumnUpdate,
 	cliSplit,
+	cliSplitByRows,
+	cliSplitColumn,
+	cliSplitTable,
+	cliRangeMin,
+	cliRangeMax,
+	cliSplitInterval,
+	cliTargetChunkTime,
 	cliFallback,
 	cliMyCnf,
 	cliDBName,
@@ -37,6 +57,24 @@ var globalFlags = []cli.Flag{
 	cliDBPassword,
 	cliExecute,
 	cliDefaultCharSet,
+	cliCheckpoint,
+	cliResume,
+	cliFailedSQLOut,
+	cliOutput,
+	cliChunkLog,
+	cliMetricsListen,
+	cliExplain,
+	cliReplica,
+	cliDiscoverReplicas,
+	cliMaxLag,
+	cliHeartbeatTable,
+	cliHeartbeatUTC,
+	cliMaxLoad,
+	cliCriticalLoad,
+	cliGalera,
+	cliMaxFlowControl,
+	cliMaxRecvQueue,
+	cliCheckInterval,
 }
 
 var cliSuppressOutput = cli.BoolFlag{
@@ -72,8 +110,20 @@ var cliParallel = cli.IntFlag{
 
 var cliMaxRetry = cli.IntFlag{
 	Name:  "max-retry",
-	Usage: "Set max retries for query execution.",
-	Value: 3,
+	Usage: "Set max retries of each query failed with deadlock, lock wait timeout or lost connection.",
+	Value: splmysql.DefaultMaxRetry,
+}
+
+var cliRetryBackoff = cli.DurationFlag{
+	Name:  "retry-backoff",
+	Usage: "Wait time before the first retry. It doubles for each retry, with jitter.",
+	Value: splmysql.DefaultInitialBackoff,
+}
+
+var cliMaxRetryBackoff = cli.DurationFlag{
+	Name:  "max-retry-backoff",
+	Usage: "Upper limit of the wait time before retry.",
+	Value: splmysql.DefaultMaxBackoff,
 }
 
 var cliSplit = cli.Int64Flag{
@@ -82,16 +132,156 @@ var cliSplit = cli.Int64Flag{
 	Value: splmysql.DefaultSplitRange,
 }
 
+var cliSplitByRows = cli.BoolFlag{
+	Name:  "split-by-rows",
+	Usage: "Split UPDATE SQL by number of rows walking the index. --split is used as rows per query.",
+}
+
+var cliSplitColumn = cli.StringFlag{
+	Name:  "split-column",
+	Usage: "Split UPDATE SQL by this column, instead of auto-detection. It must be an indexed integer column.",
+}
+
+var cliSplitTable = cli.StringFlag{
+	Name:  "split-table",
+	Usage: "Split multi-table UPDATE or INSERT ... SELECT SQL by this table (alias or name), instead of the table of the first column in SET clause.",
+}
+
+var cliRangeMin = cli.StringFlag{
+	Name:  "range-min",
+	Usage: "Start splitting from this value of the split column, instead of its MIN().",
+}
+
+var cliRangeMax = cli.StringFlag{
+	Name:  "range-max",
+	Usage: "Stop splitting at this value of the split column, instead of its MAX().",
+}
+
+var cliSplitInterval = cli.DurationFlag{
+	Name:  "split-interval",
+	Usage: "Split UPDATE SQL by this interval of DATETIME, DATE or TIMESTAMP column (e.g. 1h). Default 1h for temporal column.",
+}
+
+var cliTargetChunkTime = cli.DurationFlag{
+	Name:  "target-chunk-time",
+	Usage: "Adjust split range to execute each query in this time (e.g. 500ms). --split is used as initial range.",
+}
+
 var cliShuffle = cli.BoolFlag{
 	Name:  "shuffle",
 	Usage: "Shuffle splitted UPDATE SQL execution.",
 }
 
+var cliDescending = cli.BoolFlag{
+	Name:  "descending",
+	Usage: "Execute splitted UPDATE SQL from the max value of the split column.",
+}
+
+var cliAllowSplitColumnUpdate = cli.BoolFlag{
+	Name:  "allow-split-column-update",
+	Usage: "Allow UPDATE which assigns the split column (e.g. SET id = id + 1000000). Requires --descending and --parallel 1, and safe only for increasing values.",
+}
+
 var cliFallback = cli.BoolFlag{
 	Name:  "fallback",
 	Usage: "Fallback simple UPDATE if it cannot split. Use carefully if DB is Galera Cluster.",
 }
 
+var cliCheckpoint = cli.StringFlag{
+	Name:  "checkpoint",
+	Usage: "Save the progress into this file while running. Use it with --resume.",
+}
+
+var cliResume = cli.StringFlag{
+	Name:  "resume",
+	Usage: "Resume interrupted run from this checkpoint file. Execute only queries not committed.",
+}
+
+var cliReplica = cli.StringSliceFlag{
+	Name:  "replica",
+	Usage: "Check replication lag of this replica. Set DSN like 'user:pass@tcp(host:3306)/'. Can be repeated.",
+}
+
+var cliDiscoverReplicas = cli.BoolFlag{
+	Name:  "discover-replicas",
+	Usage: "Find replicas with SHOW REPLICAS or processlist, and check replication lag. Connect with --user and --password.",
+}
+
+var cliMaxLag = cli.DurationFlag{
+	Name:  "max-lag",
+	Usage: "Pause dispatching queries while replication lag is above this value.",
+	Value: splmysql.DefaultMaxLag,
+}
+
+var cliHeartbeatTable = cli.StringFlag{
+	Name:  "heartbeat-table",
+	Usage: "Check replication lag with this pt-heartbeat table (e.g. percona.heartbeat), instead of SHOW REPLICA STATUS.",
+}
+
+var cliHeartbeatUTC = cli.BoolFlag{
+	Name:  "heartbeat-utc",
+	Usage: "The heartbeat table is written in UTC (pt-heartbeat --utc). Otherwise it's in the time zone of the replica.",
+}
+
+var cliMaxLoad = cli.StringFlag{
+	Name:  "max-load",
+	Usage: "Pause dispatching queries while SHOW GLOBAL STATUS is above this (e.g. Threads_running=50,Innodb_row_lock_current_waits=10).",
+}
+
+var cliCriticalLoad = cli.StringFlag{
+	Name:  "critical-load",
+	Usage: "Abort if SHOW GLOBAL STATUS is above this (e.g. Threads_running=100).",
+}
+
+var cliGalera = cli.BoolFlag{
+	Name:  "galera",
+	Usage: "Galera Cluster mode. Lower --split within wsrep_max_ws_rows/wsrep_max_ws_size, and pause under flow control.",
+}
+
+var cliMaxFlowControl = cli.Float64Flag{
+	Name:  "max-flow-control",
+	Usage: "Pause dispatching queries while Galera flow control paused more than this fraction of time (galera mode).",
+	Value: splmysql.DefaultMaxFlowControlPaused,
+}
+
+var cliMaxRecvQueue = cli.Int64Flag{
+	Name:  "max-recv-queue",
+	Usage: "Pause dispatching queries while wsrep_local_recv_queue is above this (galera mode). 0 means no limit.",
+	Value: splmysql.DefaultMaxRecvQueue,
+}
+
+var cliCheckInterval = cli.DurationFlag{
+	Name:  "check-interval",
+	Usage: "Interval to check replication lag, server load and Galera flow control.",
+	Value: splmysql.DefaultThrottleInterval,
+}
+
+var cliFailedSQLOut = cli.StringFlag{
+	Name:  "failed-sql-out",
+	Usage: "Write queries failed after retries into this file, with the errors as comments.",
+}
+
+var cliOutput = cli.StringFlag{
+	Name:  "output",
+	Usage: "Output format of the result, 'text' or 'json'. With 'json', logs are written to stderr.",
+	Value: "text",
+}
+
+var cliChunkLog = cli.StringFlag{
+	Name:  "chunk-log",
+	Usage: "Append a line of JSON for each executed query into this file (e.g. chunks.jsonl).",
+}
+
+var cliMetricsListen = cli.StringFlag{
+	Name:  "metrics-listen",
+	Usage: "Serve Prometheus metrics on this address (e.g. :9104).",
+}
+
+var cliExplain = cli.BoolFlag{
+	Name:  "explain",
+	Usage: "EXPLAIN sample queries before executing, and warn if they scan the whole table.",
+}
+
 /*
  Following options similar to mysql command
 */
@@ -133,7 +323,7 @@ var cliDBPassword = cli.StringFlag{
 
 var cliExecute = cli.StringFlag{
 	Name:  "execute, e",
-	Usage: "UPDATE query.",
+	Usage: "UPDATE, DELETE, INSERT ... SELECT or REPLACE ... SELECT query.",
 }
 
 var cliDefaultCharSet = cli.StringFlag{
@@ -145,26 +335,252 @@ var cliDefaultCharSet = cli.StringFlag{
 // create logger
 var logger = logrus.New()
 
-func doUpdate(sr *splmysql.Runner, sessionData *splmysql.Session, parallel int, maxRetry int, cnt int) (err error) {
-	// execute parallel
-	retrySessionData, err := sr.RunParallel(sessionData, parallel)
-	// retry
+func doUpdate(ctx context.Context, sr *splmysql.Runner, sessionData *splmysql.Session, parallel int) (err error) {
+	// execute parallel. each query is retried in splmysql.
+	_, err = sr.RunParallelContext(ctx, sessionData, parallel)
 	if err != nil {
-		logger.Warnf("Session %d failed: %s\n", cnt, err.Error())
-		logger.Debugf("Retry %d/%d: execute %d transactions.",
-			cnt+1, maxRetry, retrySessionData.GetSessionResult().Plan)
-
-		return doUpdate(sr, retrySessionData, parallel, maxRetry, cnt+1)
+		if _, ok := err.(*splmysql.CanceledError); !ok {
+			logger.Warnf("Session failed: %s\n", err.Error())
+		}
 	}
 	return
 }
 
-func doMain(c *cli.Context) (err error) {
+// serveMetrics serves Prometheus metrics on '/metrics' in background.
+func serveMetrics(addr string, metrics *splmysql.Metrics) error {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(metrics); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logger.Errorf("Metrics server stopped: %s", err.Error())
+		}
+	}()
+	logger.Infof("Serve metrics on http://%s/metrics", listener.Addr())
+	return nil
+}
+
+// jsonResult is the result printed with '--output json'.
+type jsonResult struct {
+	Result      splmysql.Result `json:"result"`
+	Sessions    []jsonSession   `json:"sessions"`
+	Interrupted bool            `json:"interrupted"`
+	Unprocessed []string        `json:"unprocessed,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// jsonSession is a session in jsonResult. Round is 0 for the first session, and counts up for retries.
+type jsonSession struct {
+	Round                    int             `json:"round"`
+	DBName                   string          `json:"db_name"`
+	TableName                string          `json:"table_name"`
+	SplitMode                string          `json:"split_mode"`
+	SplitTable               string          `json:"split_table,omitempty"`
+	SplittableColumn         string          `json:"splittable_column"`
+	SplittableColumnMinValue interface{}     `json:"splittable_column_min_value"`
+	SplittableColumnMaxValue interface{}     `json:"splittable_column_max_value"`
+	SplitRange               int64           `json:"split_range"`
+	SplittableColumnMinTime  string          `json:"splittable_column_min_time,omitempty"`
+	SplittableColumnMaxTime  string          `json:"splittable_column_max_time,omitempty"`
+	SplitInterval            string          `json:"split_interval,omitempty"`
+	Result                   splmysql.Result `json:"result"`
+}
+
+// timeLayout is the layout of temporal values of split column in the output.
+const timeLayout = "2006-01-02 15:04:05.999999"
+
+// printJSONResult prints the result of all sessions as a JSON document.
+func printJSONResult(sr *splmysql.Runner, err error, interrupted bool) {
+	out := jsonResult{
+		Result:      splmysql.NewResult(0),
+		Sessions:    []jsonSession{},
+		Interrupted: interrupted,
+	}
+	for n, sess := range sr.Sessions {
+		sessResult := sess.GetSessionResult()
+		out.Result.Append(sessResult)
+		min, max := sess.GetSplittableColumnRange()
+		js := jsonSession{
+			Round:                    n,
+			DBName:                   sess.DBName,
+			TableName:                sess.TableName,
+			SplitMode:                sess.SplitMode.String(),
+			SplitTable:               sess.SplitTable,
+			SplittableColumn:         sess.SplittableColumn,
+			SplittableColumnMinValue: min,
+			SplittableColumnMaxValue: max,
+			SplitRange:               sess.SplitRange,
+			Result:                   sessResult,
+		}
+		if sess.SplitMode == splmysql.SplitByTime {
+			js.SplittableColumnMinTime = sess.SplittableColumnMinTime.Format(timeLayout)
+			js.SplittableColumnMaxTime = sess.SplittableColumnMaxTime.Format(timeLayout)
+			js.SplitInterval = sess.SplitInterval.String()
+		}
+		out.Sessions = append(out.Sessions, js)
+	}
+	if interrupted && len(sr.Sessions) > 0 {
+		out.Unprocessed = sr.Sessions[len(sr.Sessions)-1].GetUnprocessedRanges()
+	}
+	if err != nil {
+		out.Error = strings.TrimSpace(err.Error())
+	}
+
+	data, jerr := json.MarshalIndent(out, "", "  ")
+	if jerr != nil {
+		logger.Errorf("Failed to output JSON: %s", jerr.Error())
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// planPreviewQueries is the number of the first and the last queries printed in dryrun.
+const planPreviewQueries = 3
+
+// explainSession prints EXPLAIN of sample queries, and warns full scans and the other indexes.
+func explainSession(ctx context.Context, sr *splmysql.Runner, sess *splmysql.Session) {
+	results, err := sr.ExplainSession(ctx, sess, splmysql.DefaultExplainSamples)
+	if err != nil {
+		logger.Errorf("Failed to EXPLAIN: %s", err.Error())
+	}
+	for _, r := range results {
+		if r.FullScan {
+			logger.Warnf("EXPLAIN: (%d) %s: full scan (type=%s key=%s rows=%d), not range scan on '%s'.",
+				r.ID, r.Range, r.Type, r.Key, r.Rows, sess.SplittableColumn)
+			continue
+		}
+		if r.OtherKey {
+			logger.Warnf("EXPLAIN: (%d) %s: key=%s is not the index of '%s' (type=%s rows=%d).",
+				r.ID, r.Range, r.Key, sess.SplittableColumn, r.Type, r.Rows)
+			continue
+		}
+		logger.Infof("EXPLAIN: (%d) %s: type=%s key=%s rows=%d", r.ID, r.Range, r.Type, r.Key, r.Rows)
+	}
+}
+
+// writeFailedSQL writes the queries of failed transactions into the file.
+func writeFailedSQL(path string, sessions []*splmysql.Session) (n int, err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	for _, sess := range sessions {
+		written, err := sess.WriteFailedSQL(f)
+		n += written
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, f.Sync()
+}
+
+// jsonEstimate is the estimate printed with '--output json'.
+type jsonEstimate struct {
+	splmysql.Estimate
+	Densest     []splmysql.ChunkEstimate `json:"densest"`
+	Interrupted bool                     `json:"interrupted"`
+	Error       string                   `json:"error,omitempty"`
+}
+
+// printEstimate prints the estimate, even if it's partial.
+func printEstimate(est splmysql.Estimate, err error, interrupted bool, output string) error {
+	if err != nil && len(est.Chunks) == 0 && !interrupted {
+		return estimateExitError(err)
+	}
+
+	if output == "json" {
+		out := jsonEstimate{
+			Estimate:    est,
+			Densest:     est.Densest(splmysql.DefaultEstimateDensest),
+			Interrupted: interrupted,
+		}
+		if err != nil {
+			out.Error = strings.TrimSpace(err.Error())
+		}
+		data, jerr := json.MarshalIndent(out, "", "  ")
+		if jerr != nil {
+			logger.Errorf("Failed to output JSON: %s", jerr.Error())
+		} else {
+			fmt.Println(string(data))
+		}
+	} else {
+		// Output estimate force
+		loglevelBefore := logger.Level
+		logger.Level = logrus.InfoLevel
+		logger.Infof("ESTIMATE: %d rows match in %d queries, counted in %s.",
+			est.Rows, len(est.Chunks), est.Elapsed.Round(time.Millisecond))
+		for _, chunk := range est.Densest(splmysql.DefaultEstimateDensest) {
+			logger.Infof("ESTIMATE: densest (%d) %s: %d rows", chunk.ID, chunk.Range, chunk.Rows)
+		}
+		logger.Infof("ESTIMATE: projected runtime %s at least.", est.ProjectedRuntime.Round(time.Second))
+		logger.Level = loglevelBefore
+	}
+
+	if interrupted {
+		return cli.NewExitError("Interrupted.", 130)
+	}
+	if err != nil {
+		return estimateExitError(err)
+	}
+	return nil
+}
+
+// estimateExitError returns ExitError with the code of splmysql errors.
+func estimateExitError(err error) error {
+	if e, ok := err.(interface{ Code() int }); ok {
+		return cli.NewExitError(strings.TrimSpace(err.Error()), e.Code())
+	}
+	return cli.NewExitError(strings.TrimSpace(err.Error()), 1)
+}
+
+// handleSignals cancels ctx at the first signal, and exits at the second signal.
+func handleSignals(cancel context.CancelFunc) {
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		logger.Errorf("Received %s. Waiting for running queries to finish. Send it again to abort.", sig)
+		cancel()
+
+		sig = <-sigChan
+		logger.Errorf("Received %s again. Abort.", sig)
+		os.Exit(130)
+	}()
+}
+
+func doMain(c *cli.Context) error {
+	return run(c, false)
+}
+
+func doEstimate(c *cli.Context) error {
+	return run(c, true)
+}
+
+// run executes the query, or estimates the rows matched by the query if estimate is true.
+func run(c *cli.Context, estimate bool) (err error) {
 	logger.Formatter = &logrus.TextFormatter{
 		FullTimestamp: false,
 	}
 	logger.Out = os.Stdout
 
+	output := c.String("output")
+	if output != "text" && output != "json" {
+		return cli.NewExitError(fmt.Sprintf("Invalid output format '%s', use 'text' or 'json'.", output), 1)
+	}
+	if output == "json" {
+		// stdout is for the JSON document only.
+		logger.Out = os.Stderr
+	}
+
 	// split commandline args
 	mycnf := c.String("conf")
 	host := c.String("host")
@@ -191,14 +607,114 @@ func doMain(c *cli.Context) (err error) {
 	}
 	defer sr.Close()
 
+	var interrupted bool
+	if output == "json" && !estimate {
+		defer func() {
+			printJSONResult(&sr, err, interrupted)
+		}()
+	}
+
 	// set parameters
 	sr.UseDryRun = c.Bool("dryrun")
 	sr.SetSplitRange(c.Int64("split"))
 	sr.UseShuffle = c.Bool("shuffle")
+	sr.UseDescending = c.Bool("descending")
+	sr.AllowSplitColumnUpdate = c.Bool("allow-split-column-update")
+	sr.UseRowCountSplit = c.Bool("split-by-rows")
+	sr.SplitColumn = c.String("split-column")
+	sr.SplitTable = c.String("split-table")
+	sr.SplitInterval = c.Duration("split-interval")
+	sr.RangeMin = c.String("range-min")
+	sr.RangeMax = c.String("range-max")
+	sr.TargetChunkTime = c.Duration("target-chunk-time")
+
+	resume := c.String("resume")
+	sr.CheckpointFile = c.String("checkpoint")
+	if resume != "" && sr.CheckpointFile == "" {
+		sr.CheckpointFile = resume
+	}
+
+	// replication lag throttling
+	var replicas []*splmysql.Replica
+	defer func() {
+		for _, r := range replicas {
+			r.Close()
+		}
+	}()
+	for _, dsn := range c.StringSlice("replica") {
+		r, err := splmysql.NewReplica(dsn)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Invalid replica DSN: %s", err.Error()), 1)
+		}
+		replicas = append(replicas, r)
+	}
+	if c.Bool("discover-replicas") {
+		addrs, err := sr.DiscoverReplicas(context.Background(), port)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Failed to discover replicas: %s", err.Error()), 1)
+		}
+		for _, addr := range addrs {
+			logger.Infof("Found replica %s", addr)
+			r, err := splmysql.NewReplicaByOptions(addr, user, pwd)
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			replicas = append(replicas, r)
+		}
+	}
+	if len(replicas) > 0 {
+		sr.Throttlers = append(sr.Throttlers, &splmysql.ReplicaLagThrottler{
+			Replicas:       replicas,
+			MaxLag:         c.Duration("max-lag"),
+			HeartbeatTable: c.String("heartbeat-table"),
+			HeartbeatUTC:   c.Bool("heartbeat-utc"),
+		})
+	}
+
+	// server load throttling
+	maxLoad, err := splmysql.ParseLoadOption(c.String("max-load"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	criticalLoad, err := splmysql.ParseLoadOption(c.String("critical-load"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if len(maxLoad) > 0 || len(criticalLoad) > 0 {
+		sr.Throttlers = append(sr.Throttlers, sr.NewLoadThrottler(maxLoad, criticalLoad))
+	}
+
+	// Galera Cluster mode
+	if c.Bool("galera") {
+		sr.UseGalera = true
+		sr.Throttlers = append(sr.Throttlers,
+			sr.NewGaleraThrottler(c.Float64("max-flow-control"), c.Int64("max-recv-queue")))
+	}
+	sr.ThrottleInterval = c.Duration("check-interval")
 
 	fallback := c.Bool("fallback")
+	explain := c.Bool("explain")
 	parallel := c.Int("parallel")
-	maxretry := c.Int("max-retry")
+	sr.RetryPolicy.MaxRetry = c.Int("max-retry")
+	sr.RetryPolicy.InitialBackoff = c.Duration("retry-backoff")
+	sr.RetryPolicy.MaxBackoff = c.Duration("max-retry-backoff")
+
+	if metricsListen := c.String("metrics-listen"); metricsListen != "" {
+		metrics := sr.NewMetrics()
+		sr.TransactionHandlers = append(sr.TransactionHandlers, metrics.ObserveTransaction)
+		if err := serveMetrics(metricsListen, metrics); err != nil {
+			return cli.NewExitError(fmt.Sprintf("Failed to listen metrics: %s", err.Error()), 1)
+		}
+	}
+
+	if chunkLog := c.String("chunk-log"); chunkLog != "" {
+		f, err := os.OpenFile(chunkLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Failed to open chunk log: %s", err.Error()), 1)
+		}
+		defer f.Close()
+		sr.TransactionHandlers = append(sr.TransactionHandlers, splmysql.NewChunkLogHandler(f))
+	}
 
 	showProgress := false
 	if c.Bool("suppress") {
@@ -215,7 +731,7 @@ func doMain(c *cli.Context) (err error) {
 		logger.Level = logrus.DebugLevel
 		sr.SetLogLevel(splmysql.LogTraceLevel)
 	} else {
-		showProgress = true
+		showProgress = output == "text" && !estimate
 		logger.Level = logrus.WarnLevel
 		sr.SetLogLevel(splmysql.LogDefaultLevel)
 	}
@@ -223,6 +739,11 @@ func doMain(c *cli.Context) (err error) {
 	// Overide Logger
 	sr.Logger = logger
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handleSignals(cancel)
+
+	var est splmysql.Estimate
 	var wg sync.WaitGroup
 	errChan := make(chan error, 1)
 	wg.Add(1)
@@ -230,12 +751,26 @@ func doMain(c *cli.Context) (err error) {
 		defer wg.Done()
 
 		// Create session. If error occures, return simply
-		sess, err := sr.NewSession(sql)
+		var sess *splmysql.Session
+		var err error
+		if resume != "" {
+			sess, err = sr.ResumeSession(resume)
+		} else {
+			sess, err = sr.NewSessionContext(ctx, sql)
+		}
 		if err != nil {
 			errChan <- err
 			return err
 		}
-		errChan <- doUpdate(&sr, sess, parallel, maxretry, 0)
+		if explain {
+			explainSession(ctx, &sr, sess)
+		}
+		if estimate {
+			est, err = sr.EstimateContext(ctx, sess, parallel)
+			errChan <- err
+			return err
+		}
+		errChan <- doUpdate(ctx, &sr, sess, parallel)
 		return nil
 	}()
 
@@ -248,24 +783,34 @@ func doMain(c *cli.Context) (err error) {
 		pBars := map[int]*uiprogress.Bar{}
 
 		updateProgressbar := func() {
-			for i, session := range sr.Sessions {
+			for i, session := range sr.GetSessions() {
 				sessResult := session.GetSessionResult()
 				if sessResult.Plan <= 0 {
 					continue
 				}
 				if _, ok := pBars[i]; !ok {
+					sess := session
 					bar := uiprogress.AddBar(int(sessResult.Plan)).
 						PrependFunc(func(b *uiprogress.Bar) string {
 							return fmt.Sprintf("Session:%d %s", i, b.CompletedPercentString())
 						}).
 						AppendFunc(func(b *uiprogress.Bar) string {
 							elapsed := time.Now().Sub(b.TimeStarted)
-							return fmt.Sprintf("%d/%d %3dm%02ds", b.Current(), b.Total, int(elapsed.Minutes()), int(elapsed.Seconds())%60)
+							s := fmt.Sprintf("%d/%d %3dm%02ds", b.Current(), b.Total, int(elapsed.Minutes()), int(elapsed.Seconds())%60)
+							if sr.TargetChunkTime > 0 {
+								s += fmt.Sprintf(" range:%d", sess.GetCurrentSplitRange())
+							}
+							if sess.GetThrottleReason() != "" {
+								s += " paused"
+							}
+							return s
 						})
 					bar.TimeStarted = time.Now()
 					pBars[i] = bar
 				}
 
+				// planned queries change with adaptive split range
+				pBars[i].Total = int(sessResult.Plan)
 				pBars[i].Set(int(sessResult.Executed))
 			}
 		}
@@ -290,8 +835,18 @@ func doMain(c *cli.Context) (err error) {
 		uiprogress.Stop()
 	}
 
+	if estimate {
+		return printEstimate(est, err, ctx.Err() != nil, output)
+	}
+
+	// interrupted by signal, output partial result.
+	_, interrupted = err.(*splmysql.CanceledError)
+	if interrupted {
+		err = cli.NewExitError("Interrupted.", 130)
+	}
+
 	// error handle and fallback to SimpleUpdate
-	if err != nil {
+	if err != nil && !interrupted {
 		e := reflect.ValueOf(err).Elem()
 		switch {
 		case e.Type() == reflect.TypeOf(splmysql.NoUsableColumnError{}):
@@ -320,8 +875,25 @@ func doMain(c *cli.Context) (err error) {
 			e2 := e.Interface().(splmysql.InvalidUpdateQueryError)
 			return cli.NewExitError(e2.Error(), e2.Code())
 
+		case e.Type() == reflect.TypeOf(splmysql.InvalidSplitColumnError{}):
+			e2 := e.Interface().(splmysql.InvalidSplitColumnError)
+			return cli.NewExitError(e2.Error(), e2.Code())
+
+		case e.Type() == reflect.TypeOf(splmysql.SplitColumnUpdateError{}):
+			e2 := e.Interface().(splmysql.SplitColumnUpdateError)
+			return cli.NewExitError(e2.Error(), e2.Code())
+
+		case e.Type() == reflect.TypeOf(splmysql.CriticalLoadError{}):
+			// aborted while running, output partial result.
+			e2 := e.Interface().(splmysql.CriticalLoadError)
+			err = cli.NewExitError(e2.Error(), e2.Code())
+
 		default:
-			return cli.NewExitError(err.Error(), 1)
+			if len(sr.Sessions) == 0 {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			// failed while running, output result.
+			err = cli.NewExitError(err.Error(), 1)
 		}
 	}
 
@@ -344,8 +916,51 @@ func doMain(c *cli.Context) (err error) {
 	// Output result force
 	loglevelBefore := logger.Level
 	logger.Level = logrus.InfoLevel
+	if sr.UseDryRun && len(sr.Sessions) > 0 {
+		plan := sr.Sessions[0]
+		logger.Infof("PLAN: [%s.%s] split by %s on '%s': %d queries planned.",
+			plan.DBName, plan.TableName, plan.SplitMode, plan.SplittableColumn, firstPlanned)
+		if plan.SplitTable != "" {
+			logger.Infof("PLAN: multi-table query is split by the table '%s'.", plan.SplitTable)
+		}
+		switch plan.SplitMode {
+		case splmysql.SplitByRange:
+			min, max := plan.GetSplittableColumnRange()
+			logger.Infof("PLAN: '%s' min %d - max %d, split range %d.",
+				plan.SplittableColumn, min, max, plan.SplitRange)
+		case splmysql.SplitByTime:
+			logger.Infof("PLAN: '%s' min '%s' - max '%s', split interval %s.",
+				plan.SplittableColumn, plan.SplittableColumnMinTime.Format(timeLayout),
+				plan.SplittableColumnMaxTime.Format(timeLayout), plan.SplitInterval)
+		default:
+			logger.Infof("PLAN: %d rows per query at most.", plan.SplitRange)
+		}
+		first, last := plan.GetPlannedSQL(planPreviewQueries)
+		for _, q := range first {
+			logger.Infof("PLAN: %s;", q)
+		}
+		if len(last) > 0 {
+			logger.Infof("PLAN: ...")
+		}
+		for _, q := range last {
+			logger.Infof("PLAN: %s;", q)
+		}
+	}
 	logger.Infof("RESULT: %d queries affected and %d rows updated. %d queries failed.",
 		totalResult.Succeeded, totalResult.RowsAffected, finallyFailed)
+	if interrupted && len(sr.Sessions) > 0 {
+		for _, r := range sr.Sessions[len(sr.Sessions)-1].GetUnprocessedRanges() {
+			logger.Infof("UNPROCESSED: %s", r)
+		}
+	}
+	if failedSQLOut := c.String("failed-sql-out"); failedSQLOut != "" && finallyFailed > 0 {
+		n, werr := writeFailedSQL(failedSQLOut, sr.Sessions)
+		if werr != nil {
+			logger.Errorf("Failed to write failed queries into %s: %s", failedSQLOut, werr.Error())
+		} else {
+			logger.Infof("FAILED SQL: %d queries written into %s", n, failedSQLOut)
+		}
+	}
 	logger.Level = loglevelBefore
 	return err
 }
@@ -363,11 +978,20 @@ func main() {
 	app := cli.NewApp()
 	app.Name = "split_mysql"
 	app.Version = Version
-	app.Usage = "Split large update transaction query into small transaction queries."
+	app.Usage = "Split large UPDATE/DELETE/INSERT ... SELECT transaction query into small transaction queries."
 	app.UsageText = fmt.Sprintf("%s [-c CONF|-h HOST -u USER -p PASSWD] -D DATABASE -e QUERY", app.Name)
 	app.Author = "etsxxx"
 	app.Flags = globalFlags
 	app.Action = doMain
+	app.Commands = []cli.Command{
+		{
+			Name:      "estimate",
+			Usage:     "Count rows matched by the query in each splitted range, without writing.",
+			UsageText: fmt.Sprintf("%s estimate [-c CONF|-h HOST -u USER -p PASSWD] -D DATABASE -e QUERY", app.Name),
+			Flags:     globalFlags,
+			Action:    doEstimate,
+		},
+	}
 
 	app.Run(os.Args)
 }
@@ -0,0 +1,83 @@
+package splmysql
+
+/*
+Adaptive split range, like '--chunk-time' of pt-online-schema-change.
+The range of the next transaction grows or shrinks from the measured duration of recent transactions.
+*/
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// chunkSizerWeight is the weight of past average in the weighted average of the processing rate.
+const chunkSizerWeight = 0.75
+
+// chunkSizer calculates the range of the next transaction to finish in the target time.
+type chunkSizer struct {
+	mutex  sync.Mutex
+	target time.Duration
+	size   int64
+	// rate is the weighted average of the processed range per second.
+	rate float64
+	// maxSize is the upper limit of size. 0 means no limit.
+	maxSize int64
+}
+
+// newChunkSizer creates chunkSizer. maxSize is the upper limit of the size, 0 means no limit.
+func newChunkSizer(target time.Duration, initialSize int64, maxSize int64) *chunkSizer {
+	if initialSize <= 0 {
+		initialSize = 1
+	}
+	if maxSize > 0 && initialSize > maxSize {
+		initialSize = maxSize
+	}
+	return &chunkSizer{
+		target:  target,
+		size:    initialSize,
+		maxSize: maxSize,
+	}
+}
+
+// getSize returns the range of the next transaction.
+func (cs *chunkSizer) getSize() int64 {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return cs.size
+}
+
+// update records the range and the elapsed time of a finished transaction, and calculates the next size.
+// The size grows twice at most at once, because empty ranges finish too fast.
+func (cs *chunkSizer) update(rangeSize int64, elapsed time.Duration) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if rangeSize <= 0 {
+		return
+	}
+	if elapsed < time.Millisecond {
+		elapsed = time.Millisecond
+	}
+	rate := float64(rangeSize) / elapsed.Seconds()
+	if cs.rate == 0 {
+		cs.rate = rate
+	} else {
+		cs.rate = chunkSizerWeight*cs.rate + (1-chunkSizerWeight)*rate
+	}
+
+	size := cs.rate * cs.target.Seconds()
+	switch {
+	case size >= float64(cs.size)*2:
+		if cs.size < math.MaxInt64/2 {
+			cs.size *= 2
+		}
+	case size < 1:
+		cs.size = 1
+	default:
+		cs.size = int64(size)
+	}
+	if cs.maxSize > 0 && cs.size > cs.maxSize {
+		cs.size = cs.maxSize
+	}
+}
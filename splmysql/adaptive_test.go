@@ -0,0 +1,91 @@
+package splmysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkSizerUpdate(t *testing.T) {
+	cs := newChunkSizer(500*time.Millisecond, 1000, 0)
+	assert.Equal(t, int64(1000), cs.getSize())
+
+	// 1000 in 250ms, wants 2000 in 500ms.
+	cs.update(1000, 250*time.Millisecond)
+	assert.Equal(t, int64(2000), cs.getSize())
+
+	// grows twice at most, even if it finished too fast.
+	cs.update(2000, time.Millisecond)
+	assert.Equal(t, int64(4000), cs.getSize())
+
+	// shrinks if it's slow.
+	cs = newChunkSizer(500*time.Millisecond, 1000, 0)
+	cs.update(1000, 2*time.Second)
+	assert.Equal(t, int64(250), cs.getSize())
+
+	// never be less than 1.
+	cs = newChunkSizer(time.Millisecond, 1, 0)
+	cs.update(1, time.Minute)
+	assert.Equal(t, int64(1), cs.getSize())
+
+	// ignore empty range
+	cs = newChunkSizer(time.Second, 10, 0)
+	cs.update(0, time.Minute)
+	assert.Equal(t, int64(10), cs.getSize())
+
+	// never be more than maxSize.
+	cs = newChunkSizer(time.Second, 1000, 1500)
+	cs.update(1000, 250*time.Millisecond)
+	assert.Equal(t, int64(1500), cs.getSize())
+	// initial size is capped too.
+	cs = newChunkSizer(time.Second, 1000, 100)
+	assert.Equal(t, int64(100), cs.getSize())
+}
+
+func TestNextTransactionAdaptive(t *testing.T) {
+	sess := &Session{
+		SplittableColumnMinValue: 5,
+		SplittableColumnMaxValue: 104,
+		SplitRange:               10,
+		sizer:                    newChunkSizer(time.Second, 10, 0),
+		nextRangeStart:           5,
+		result:                   NewResult(10),
+	}
+
+	tx := sess.nextTransaction()
+	assert.Equal(t, int64(1), tx.id)
+	assert.Equal(t, []interface{}{int64(5)}, tx.rangeStart)
+	assert.Equal(t, []interface{}{int64(14)}, tx.rangeEnd)
+	assert.Equal(t, int64(10), sess.GetSessionResult().Plan)
+
+	// 10 in 250ms, next range is 20.
+	sess.sizer.update(10, 250*time.Millisecond)
+	assert.Equal(t, int64(20), sess.GetCurrentSplitRange())
+	tx = sess.nextTransaction()
+	assert.Equal(t, []interface{}{int64(15)}, tx.rangeStart)
+	assert.Equal(t, []interface{}{int64(34)}, tx.rangeEnd)
+	// 2 dispatched and 70 remains
+	assert.Equal(t, int64(6), sess.GetSessionResult().Plan)
+
+	// last one is clipped by max value
+	sess.sizer.update(20, 100*time.Millisecond)
+	sess.sizer.update(40, 100*time.Millisecond)
+	sess.sizer.update(80, 100*time.Millisecond)
+	tx = sess.nextTransaction()
+	assert.Equal(t, []interface{}{int64(35)}, tx.rangeStart)
+	assert.Equal(t, []interface{}{int64(104)}, tx.rangeEnd)
+	assert.Equal(t, int64(3), sess.GetSessionResult().Plan)
+
+	assert.Nil(t, sess.nextTransaction())
+	assert.Equal(t, 3, len(sess.transactions))
+}
+
+func TestNextTransactionFixed(t *testing.T) {
+	sess := &Session{
+		transactions: newKeysetTransactions([][]interface{}{{int64(1)}, {int64(2)}}),
+	}
+	assert.Equal(t, int64(1), sess.nextTransaction().id)
+	assert.Equal(t, int64(2), sess.nextTransaction().id)
+	assert.Nil(t, sess.nextTransaction())
+}
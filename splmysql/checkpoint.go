@@ -0,0 +1,308 @@
+package splmysql
+
+/*
+Checkpoint saves the state of the session into the file, to resume interrupted runs.
+*/
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// SessionState is the serializable state of Session.
+type SessionState struct {
+	Query                    string             `json:"query"`
+	DBName                   string             `json:"db_name"`
+	TableName                string             `json:"table_name"`
+	SplittableColumn         string             `json:"splittable_column"`
+	SplittableColumns        []string           `json:"splittable_columns"`
+	SplittableColumnMinValue int64              `json:"splittable_column_min_value"`
+	SplittableColumnMaxValue int64              `json:"splittable_column_max_value"`
+	SplittableColumnUnsigned bool               `json:"splittable_column_unsigned,omitempty"`
+	SplitRange               int64              `json:"split_range"`
+	SplitMode                SplitMode          `json:"split_mode"`
+	SplitTable               string             `json:"split_table,omitempty"`
+	Transactions             []TransactionState `json:"transactions"`
+	// SplittableColumnMinTime, SplittableColumnMaxTime and SplitInterval are saved in SplitByTime mode.
+	SplittableColumnMinTime *time.Time    `json:"splittable_column_min_time,omitempty"`
+	SplittableColumnMaxTime *time.Time    `json:"splittable_column_max_time,omitempty"`
+	SplitInterval           time.Duration `json:"split_interval,omitempty"`
+	// Adaptive is true if the session creates transactions with adaptive split range.
+	Adaptive        bool          `json:"adaptive,omitempty"`
+	TargetChunkTime time.Duration `json:"target_chunk_time,omitempty"`
+	// CurrentSplitRange is the split range of the next transaction, adapted while running.
+	CurrentSplitRange int64 `json:"current_split_range,omitempty"`
+	// MaxSplitRange is the upper limit of the adapted split range, like the limit of Galera Cluster.
+	MaxSplitRange  int64 `json:"max_split_range,omitempty"`
+	NextRangeStart int64 `json:"next_range_start,omitempty"`
+	Dispatched     bool  `json:"dispatched,omitempty"`
+	// NextID is the id of the next transaction, not to reuse ids of completed transactions.
+	NextID int64 `json:"next_id,omitempty"`
+}
+
+// TransactionState is the serializable state of Transaction.
+type TransactionState struct {
+	ID         int64        `json:"id"`
+	Completed  bool         `json:"completed"`
+	Failed     bool         `json:"failed"`
+	RangeStart []StateValue `json:"range_start"`
+	RangeEnd   []StateValue `json:"range_end"`
+}
+
+// StateValue is a boundary value with its type, to keep the value exactly in JSON.
+type StateValue struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func newStateValues(values []interface{}) (stateValues []StateValue, err error) {
+	if values == nil {
+		return nil, nil
+	}
+	for _, v := range values {
+		switch val := v.(type) {
+		case int64:
+			stateValues = append(stateValues, StateValue{Type: "int", Value: strconv.FormatInt(val, 10)})
+		case uint64:
+			stateValues = append(stateValues, StateValue{Type: "uint", Value: strconv.FormatUint(val, 10)})
+		case time.Time:
+			stateValues = append(stateValues, StateValue{Type: "time", Value: val.Format(time.RFC3339Nano)})
+		case string:
+			stateValues = append(stateValues, StateValue{Type: "string", Value: val})
+		case []byte:
+			stateValues = append(stateValues, StateValue{Type: "bytes", Value: hex.EncodeToString(val)})
+		default:
+			return nil, fmt.Errorf("unsupported boundary value type %T", v)
+		}
+	}
+	return stateValues, nil
+}
+
+func parseStateValues(stateValues []StateValue) (values []interface{}, err error) {
+	if stateValues == nil {
+		return nil, nil
+	}
+	for _, sv := range stateValues {
+		switch sv.Type {
+		case "int":
+			v, err := strconv.ParseInt(sv.Value, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		case "uint":
+			v, err := strconv.ParseUint(sv.Value, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		case "time":
+			v, err := time.Parse(time.RFC3339Nano, sv.Value)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		case "string":
+			values = append(values, sv.Value)
+		case "bytes":
+			v, err := hex.DecodeString(sv.Value)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		default:
+			return nil, fmt.Errorf("unsupported boundary value type '%s'", sv.Type)
+		}
+	}
+	return values, nil
+}
+
+// GetState returns the serializable state of the session.
+func (sess *Session) GetState() (state SessionState, err error) {
+	sess.mutexTransactions.Lock()
+	defer sess.mutexTransactions.Unlock()
+
+	state = SessionState{
+		Query:                    sess.Query,
+		DBName:                   sess.DBName,
+		TableName:                sess.TableName,
+		SplittableColumn:         sess.SplittableColumn,
+		SplittableColumns:        sess.SplittableColumns,
+		SplittableColumnMinValue: sess.SplittableColumnMinValue,
+		SplittableColumnMaxValue: sess.SplittableColumnMaxValue,
+		SplittableColumnUnsigned: sess.SplittableColumnUnsigned,
+		SplitRange:               sess.SplitRange,
+		SplitMode:                sess.SplitMode,
+		SplitTable:               sess.SplitTable,
+		Transactions:             []TransactionState{},
+	}
+	if sess.SplitMode == SplitByTime {
+		minTime, maxTime := sess.SplittableColumnMinTime, sess.SplittableColumnMaxTime
+		state.SplittableColumnMinTime = &minTime
+		state.SplittableColumnMaxTime = &maxTime
+		state.SplitInterval = sess.SplitInterval
+	}
+	if sess.sizer != nil {
+		state.Adaptive = true
+		state.TargetChunkTime = sess.sizer.target
+		state.CurrentSplitRange = sess.sizer.getSize()
+		state.MaxSplitRange = sess.sizer.maxSize
+		state.NextRangeStart = sess.nextRangeStart
+		state.Dispatched = sess.sizerDone
+		state.NextID = sess.getNextID()
+	}
+	for _, tx := range sess.transactions {
+		txState := TransactionState{
+			ID:        tx.id,
+			Completed: tx.completed,
+			Failed:    tx.failed,
+		}
+		if txState.RangeStart, err = newStateValues(tx.rangeStart); err != nil {
+			return state, err
+		}
+		if txState.RangeEnd, err = newStateValues(tx.rangeEnd); err != nil {
+			return state, err
+		}
+		state.Transactions = append(state.Transactions, txState)
+	}
+	return state, nil
+}
+
+// SaveState writes the state of the session into the file atomically.
+func (sess *Session) SaveState(path string) error {
+	state, err := sess.GetState()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write temporary file and rename it, not to break the file if interrupted.
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadState reads the state of the session from the file.
+func LoadState(path string) (state SessionState, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// ResumeSession creates session data from the state file.
+// The session executes only the transactions which have not committed.
+func (sr *Runner) ResumeSession(path string) (session *Session, err error) {
+	state, err := LoadState(path)
+	if err != nil {
+		return session, err
+	}
+	if state.DBName != sr.DBName {
+		sr.warnf("The state file was saved with DB '%s', but connected to '%s'.", state.DBName, sr.DBName)
+	}
+
+	stmt, err := parseQuery(state.Query)
+	if err != nil {
+		return session, NewInvalidUpdateQueryError(err.Error())
+	}
+
+	var qualifier sqlparser.TableName
+	if state.SplitTable != "" {
+		ref, _, err := getDrivingTable(stmt, state.SplitTable)
+		if err != nil {
+			return session, NewInvalidUpdateQueryError(err.Error())
+		}
+		qualifier = ref.qualifier()
+	}
+
+	nextID := state.NextID
+	transactions := []*Transaction{}
+	for _, txState := range state.Transactions {
+		if txState.ID >= nextID {
+			nextID = txState.ID + 1
+		}
+		if txState.Completed && !txState.Failed {
+			continue
+		}
+		tx := &Transaction{id: txState.ID}
+		if tx.rangeStart, err = parseStateValues(txState.RangeStart); err != nil {
+			return session, err
+		}
+		if tx.rangeEnd, err = parseStateValues(txState.RangeEnd); err != nil {
+			return session, err
+		}
+		transactions = append(transactions, tx)
+	}
+
+	session = &Session{
+		Query:                    state.Query,
+		DBName:                   state.DBName,
+		TableName:                state.TableName,
+		SplittableColumn:         state.SplittableColumn,
+		SplittableColumns:        state.SplittableColumns,
+		SplittableColumnMinValue: state.SplittableColumnMinValue,
+		SplittableColumnMaxValue: state.SplittableColumnMaxValue,
+		SplittableColumnUnsigned: state.SplittableColumnUnsigned,
+		SplitRange:               state.SplitRange,
+		SplitMode:                state.SplitMode,
+		SplitTable:               state.SplitTable,
+		stmt:                     stmt,
+		transactions:             transactions,
+		result:                   NewResult(int64(len(transactions))),
+		qualifier:                qualifier,
+	}
+	if state.SplittableColumnMinTime != nil && state.SplittableColumnMaxTime != nil {
+		session.SplittableColumnMinTime = *state.SplittableColumnMinTime
+		session.SplittableColumnMaxTime = *state.SplittableColumnMaxTime
+		session.SplitInterval = state.SplitInterval
+	}
+	if state.Adaptive && !state.Dispatched {
+		// continue to create transactions with adaptive split range.
+		target := state.TargetChunkTime
+		if sr.TargetChunkTime > 0 {
+			target = sr.TargetChunkTime
+		}
+		// continue with the split range adapted before interrupted.
+		size := state.SplitRange
+		if state.CurrentSplitRange > 0 {
+			size = state.CurrentSplitRange
+		}
+		session.sizer = newChunkSizer(target, size, state.MaxSplitRange)
+		session.nextRangeStart = state.NextRangeStart
+		session.nextID = nextID
+		session.result.Plan += countRanges(toPosition(state.NextRangeStart, state.SplittableColumnUnsigned),
+			toPosition(state.SplittableColumnMaxValue, state.SplittableColumnUnsigned), size)
+	}
+
+	sr.debugf("[%s.%s] Resume session: %d of %d queries remain.",
+		session.DBName, session.TableName, len(transactions), len(state.Transactions))
+
+	return session, nil
+}
@@ -0,0 +1,167 @@
+package splmysql
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateValues(t *testing.T) {
+	values := []interface{}{int64(-1), int64(9223372036854775807)}
+	stateValues, err := newStateValues(values)
+	assert.Nil(t, err)
+	assert.Equal(t, []StateValue{{"int", "-1"}, {"int", "9223372036854775807"}}, stateValues)
+
+	parsed, err := parseStateValues(stateValues)
+	assert.Nil(t, err)
+	assert.Equal(t, values, parsed)
+
+	values = []interface{}{uint64(0), uint64(18446744073709551615)}
+	stateValues, err = newStateValues(values)
+	assert.Nil(t, err)
+	assert.Equal(t, []StateValue{{"uint", "0"}, {"uint", "18446744073709551615"}}, stateValues)
+	parsed, err = parseStateValues(stateValues)
+	assert.Nil(t, err)
+	assert.Equal(t, values, parsed)
+
+	values = []interface{}{"7c9e6679-7425-40de-944b-e07fc1f90ae7", []byte{0x00, 0xff}}
+	stateValues, err = newStateValues(values)
+	assert.Nil(t, err)
+	assert.Equal(t, []StateValue{{"string", "7c9e6679-7425-40de-944b-e07fc1f90ae7"}, {"bytes", "00ff"}}, stateValues)
+	parsed, err = parseStateValues(stateValues)
+	assert.Nil(t, err)
+	assert.Equal(t, values, parsed)
+
+	stateValues, err = newStateValues(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, stateValues)
+
+	_, err = newStateValues([]interface{}{1.5})
+	assert.NotNil(t, err)
+	_, err = parseStateValues([]StateValue{{"unknown", "1"}})
+	assert.NotNil(t, err)
+}
+
+func TestSaveAndResumeSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "splmysql")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	stmt, err := parseQuery("UPDATE foo SET yo = 'hey'")
+	assert.Nil(t, err)
+	transactions := newKeysetTransactions([][]interface{}{
+		{int64(1), int64(10)},
+		{int64(2), int64(20)},
+		{int64(3), int64(30)},
+	})
+	sess := &Session{
+		Query:             "UPDATE foo SET yo = 'hey'",
+		DBName:            "db",
+		TableName:         "foo",
+		SplittableColumn:  "tenant_id,id",
+		SplittableColumns: []string{"tenant_id", "id"},
+		SplitRange:        100,
+		SplitMode:         SplitByKeyset,
+		stmt:              stmt,
+		transactions:      transactions,
+		result:            NewResult(3),
+	}
+	sess.finishTransaction(transactions[0], nil)
+	sess.finishTransaction(transactions[1], assert.AnError)
+	assert.Nil(t, sess.SaveState(path))
+
+	sr := newRunner("db")
+	resumed, err := sr.ResumeSession(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE foo SET yo = 'hey'", resumed.Query)
+	assert.Equal(t, []string{"tenant_id", "id"}, resumed.SplittableColumns)
+	assert.Equal(t, SplitByKeyset, resumed.SplitMode)
+	assert.Equal(t, int64(2), resumed.GetSessionResult().Plan)
+
+	// failed one and not executed one remain.
+	assert.Equal(t, 2, len(resumed.transactions))
+	assert.Equal(t, int64(2), resumed.transactions[0].id)
+	assert.Equal(t, []interface{}{int64(1), int64(10)}, resumed.transactions[0].rangeStart)
+	assert.Equal(t, []interface{}{int64(2), int64(20)}, resumed.transactions[0].rangeEnd)
+	assert.False(t, resumed.transactions[0].completed)
+	assert.Equal(t, int64(3), resumed.transactions[1].id)
+
+	sql, args := resumed.getSplittedSQL(resumed.transactions[0])
+	assert.Equal(t, "update foo set yo = 'hey' where (tenant_id, id) > (?, ?) and (tenant_id, id) <= (?, ?)", sql)
+	assert.Equal(t, []interface{}{int64(1), int64(10), int64(2), int64(20)}, args)
+
+	_, err = sr.ResumeSession(filepath.Join(dir, "not_found.json"))
+	assert.NotNil(t, err)
+}
+
+func TestResumeAdaptiveSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "splmysql")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	stmt, err := parseQuery("DELETE FROM foo")
+	assert.Nil(t, err)
+	sess := &Session{
+		Query:                    "DELETE FROM foo",
+		DBName:                   "db",
+		TableName:                "foo",
+		SplittableColumn:         "id",
+		SplittableColumns:        []string{"id"},
+		SplittableColumnMinValue: 1,
+		SplittableColumnMaxValue: 100,
+		SplitRange:               10,
+		stmt:                     stmt,
+		transactions:             []*Transaction{},
+		result:                   NewResult(10),
+		sizer:                    newChunkSizer(time.Second, 10, 50),
+		nextRangeStart:           1,
+	}
+	sess.checkpointFile = path
+	tx := sess.nextTransaction()
+	// the range grows to 20 by the fast transaction.
+	sess.sizer.update(10, 500*time.Millisecond)
+	assert.Nil(t, sess.finishTransaction(tx, nil))
+
+	// checkpoint is saved by the committed transaction.
+	sr := newRunner("db")
+	resumed, err := sr.ResumeSession(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), resumed.sizer.getSize())
+	assert.Equal(t, int64(50), resumed.sizer.maxSize)
+	assert.Equal(t, int64(5), resumed.GetSessionResult().Plan)
+
+	// ids of completed transactions are not reused after resume, even if resumed twice.
+	path2 := filepath.Join(dir, "state2.json")
+	assert.Nil(t, resumed.SaveState(path2))
+	resumed2, err := sr.ResumeSession(path2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), resumed2.nextTransaction().id)
+	assert.Equal(t, int64(2), resumed.nextTransaction().id)
+
+	sess.nextTransaction()
+	assert.Nil(t, sess.finishTransaction(sess.nextTransaction(), assert.AnError))
+	assert.Nil(t, sess.SaveState(path))
+
+	resumed, err = sr.ResumeSession(path)
+	assert.Nil(t, err)
+	// 1 dispatched but not finished, 1 failed, and 50 remain.
+	assert.Equal(t, int64(5), resumed.GetSessionResult().Plan)
+
+	tx = resumed.nextTransaction()
+	assert.Equal(t, []interface{}{int64(11)}, tx.rangeStart)
+	assert.Equal(t, []interface{}{int64(30)}, tx.rangeEnd)
+	tx = resumed.nextTransaction()
+	assert.Equal(t, []interface{}{int64(31)}, tx.rangeStart)
+	assert.Equal(t, []interface{}{int64(50)}, tx.rangeEnd)
+	tx = resumed.nextTransaction()
+	assert.Equal(t, int64(4), tx.id)
+	assert.Equal(t, []interface{}{int64(51)}, tx.rangeStart)
+	assert.Equal(t, []interface{}{int64(70)}, tx.rangeEnd)
+	assert.Equal(t, time.Second, resumed.sizer.target)
+}
@@ -6,6 +6,10 @@ import "fmt"
 const (
 	InvalidUpdateQueryErrorCode = 10
 	NoUsableColumnErrorCode     = 11
+	CanceledErrorCode           = 12
+	CriticalLoadErrorCode       = 13
+	SplitColumnUpdateErrorCode  = 14
+	InvalidSplitColumnErrorCode = 15
 )
 
 // ErrorInterface is generic interface of splmysql errors.
@@ -55,3 +59,77 @@ func NewInvalidUpdateQueryError(hint string) *InvalidUpdateQueryError {
 	err.error = fmt.Errorf("%s\n", hint)
 	return &err
 }
+
+// CanceledError is the error that the execution is canceled by the context.
+type CanceledError struct {
+	SplError
+	// Result is the partial result of the session until canceled.
+	Result Result
+}
+
+// NewCanceledError create CanceledError from the error of the context.
+func NewCanceledError(cause error, result Result) *CanceledError {
+	var err CanceledError
+	err.exitcode = CanceledErrorCode
+	err.error = cause
+	err.Result = result
+	return &err
+}
+
+// Unwrap returns the error of the context, like context.Canceled.
+func (err *CanceledError) Unwrap() error {
+	return err.error
+}
+
+// CriticalLoadError is the error that the server load is above the critical limit.
+type CriticalLoadError struct {
+	SplError
+	// Variable is the name of the status variable which tripped.
+	Variable string
+	Value    int64
+	Limit    int64
+}
+
+// NewCriticalLoadError create CriticalLoadError.
+func NewCriticalLoadError(variable string, value int64, limit int64) *CriticalLoadError {
+	var err CriticalLoadError
+	err.exitcode = CriticalLoadErrorCode
+	err.error = fmt.Errorf("Critical load: %s=%d exceeds %d\n", variable, value, limit)
+	err.Variable = variable
+	err.Value = value
+	err.Limit = limit
+	return &err
+}
+
+// SplitColumnUpdateError is the error that the query assigns the split column itself.
+// Splitted queries may move rows into the ranges executed later, and update them twice or more.
+type SplitColumnUpdateError struct {
+	SplError
+	// Column is the name of the split column assigned in SET clause.
+	Column string
+}
+
+// NewSplitColumnUpdateError create SplitColumnUpdateError.
+func NewSplitColumnUpdateError(column string, hint string) *SplitColumnUpdateError {
+	var err SplitColumnUpdateError
+	err.exitcode = SplitColumnUpdateErrorCode
+	err.error = fmt.Errorf("query updates the split column '%s': %s\n", column, hint)
+	err.Column = column
+	return &err
+}
+
+// InvalidSplitColumnError is the error that the split column or its range given by options is not usable.
+type InvalidSplitColumnError struct {
+	SplError
+	// Column is the name of the split column given by options.
+	Column string
+}
+
+// NewInvalidSplitColumnError create InvalidSplitColumnError.
+func NewInvalidSplitColumnError(column string, hint string) *InvalidSplitColumnError {
+	var err InvalidSplitColumnError
+	err.exitcode = InvalidSplitColumnErrorCode
+	err.error = fmt.Errorf("Cannot split by the column '%s': %s\n", column, hint)
+	err.Column = column
+	return &err
+}
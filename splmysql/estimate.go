@@ -0,0 +1,216 @@
+package splmysql
+
+/*
+Estimate counts the rows matched by the query in each planned transaction,
+without writing anything, to see how large the job is before running it.
+*/
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// DefaultEstimateDensest is the default number of the densest chunks to report.
+const DefaultEstimateDensest = 5
+
+// ChunkEstimate is the number of matching rows in the range of a transaction.
+// For multi-table UPDATE, it's the number of the rows of the split table, not the joined rows.
+// For INSERT ... SELECT, it's the number of the rows to insert.
+type ChunkEstimate struct {
+	ID    int64  `json:"id"`
+	Range string `json:"range"`
+	Rows  int64  `json:"rows"`
+}
+
+// Estimate is the result of EstimateContext.
+type Estimate struct {
+	// Chunks are the estimates of the counted transactions in order of the range.
+	Chunks []ChunkEstimate `json:"chunks"`
+	// Rows is the total number of matching rows.
+	Rows int64 `json:"rows"`
+	// Elapsed is the time taken to count the rows.
+	Elapsed time.Duration `json:"elapsed_ns"`
+	// ProjectedRuntime is the total duration of the counts divided by parallel.
+	// It's a lower bound of the runtime, because the queries scan the same rows and also write them.
+	ProjectedRuntime time.Duration `json:"projected_runtime_ns"`
+}
+
+// Densest returns n chunks which have the most matching rows, in descending order of the rows.
+func (e Estimate) Densest(n int) []ChunkEstimate {
+	chunks := append([]ChunkEstimate{}, e.Chunks...)
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].Rows > chunks[j].Rows
+	})
+	if n < len(chunks) {
+		chunks = chunks[:n]
+	}
+	return chunks
+}
+
+// EstimateContext executes 'SELECT COUNT(*)' with the WHERE clause of the query for each planned
+// transaction of the session, in parallel and paced by Throttlers. It never writes.
+// If ctx is done, it returns the estimate of the counted transactions with ctx.Err().
+func (sr *Runner) EstimateContext(ctx context.Context, sess *Session, parallel int) (estimate Estimate, err error) {
+	transactions := sess.getPlannedTransactions()
+	sr.infof("[%s.%s] Estimate start (planned %d queries)", sess.DBName, sess.TableName, len(transactions))
+
+	semaphore := make(chan struct{}, parallel)
+	sr.db.SetMaxIdleConns(parallel)
+	sr.db.SetMaxOpenConns(parallel)
+	sr.db.SetConnMaxLifetime(0)
+
+	throttle := &throttleState{sr: sr, sess: sess}
+	chunks := make([]*ChunkEstimate, len(transactions))
+	var total time.Duration
+	var mutex sync.Mutex
+	var firstErr error
+	setErr := func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	getErr := func() error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return firstErr
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i, tx := range transactions {
+		if ctx.Err() != nil || getErr() != nil {
+			break
+		}
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+		if err := throttle.wait(ctx); err != nil {
+			setErr(err)
+			<-semaphore
+			break
+		}
+		wg.Add(1)
+		go func(i int, tx *Transaction) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			cond, args := sess.getRangeCondition(tx, false)
+			query := getCountSQL(sess.stmt, cond, sess.getCountKeys())
+			sr.tracef("Exec SQL: %s %v", query, args)
+
+			var rows int64
+			queryStart := time.Now()
+			if err := sr.db.QueryRowContext(ctx, query, args...).Scan(&rows); err != nil {
+				if ctx.Err() == nil {
+					sr.warnf("- (%d) ERROR: %s", tx.id, err.Error())
+					setErr(err)
+				}
+				return
+			}
+			elapsed := time.Since(queryStart)
+			sr.debugf("- (%d) %d rows in %s", tx.id, rows, elapsed)
+
+			mutex.Lock()
+			chunks[i] = &ChunkEstimate{ID: tx.id, Range: sess.getRangeDescription(tx), Rows: rows}
+			total += elapsed
+			mutex.Unlock()
+		}(i, tx)
+	}
+	wg.Wait()
+	estimate.Elapsed = time.Since(start)
+
+	for _, chunk := range chunks {
+		if chunk != nil {
+			estimate.Chunks = append(estimate.Chunks, *chunk)
+			estimate.Rows += chunk.Rows
+		}
+	}
+	if parallel > 0 && len(estimate.Chunks) > 0 {
+		// project the total from the counted transactions.
+		estimate.ProjectedRuntime = total / time.Duration(parallel) *
+			time.Duration(len(transactions)) / time.Duration(len(estimate.Chunks))
+	}
+
+	if ctx.Err() != nil {
+		return estimate, ctx.Err()
+	}
+	if err := getErr(); err != nil {
+		return estimate, err
+	}
+	sr.infof("[%s.%s] Estimated %d rows in %d queries.", sess.DBName, sess.TableName, estimate.Rows, len(estimate.Chunks))
+	return estimate, nil
+}
+
+// getCountKeys returns the split columns qualified with the split table in multi-table UPDATE,
+// to count the rows of the split table. It returns nil for single-table statements.
+func (sess *Session) getCountKeys() (keys sqlparser.SelectExprs) {
+	if sess.qualifier.IsEmpty() {
+		return nil
+	}
+	if _, ok := sess.stmt.(*sqlparser.Update); !ok {
+		return nil
+	}
+	for _, column := range sess.SplittableColumns {
+		keys = append(keys, &sqlparser.AliasedExpr{Expr: &sqlparser.ColName{
+			Name:      sqlparser.NewColIdent(column),
+			Qualifier: sess.qualifier,
+		}})
+	}
+	return keys
+}
+
+// getCountSQL returns 'SELECT COUNT(*)' of the rows matched by the statement and cond.
+// If keys are given, it counts the distinct keys instead of the joined rows.
+// For INSERT ... SELECT with GROUP BY or DISTINCT, it counts the rows to insert.
+func getCountSQL(stmt sqlparser.Statement, cond sqlparser.Expr, keys sqlparser.SelectExprs) string {
+	count := &sqlparser.FuncExpr{
+		Name:  sqlparser.NewColIdent("count"),
+		Exprs: sqlparser.SelectExprs{&sqlparser.StarExpr{}},
+	}
+	if len(keys) > 0 {
+		count.Distinct = true
+		count.Exprs = keys
+	}
+
+	var tables sqlparser.TableExprs
+	var where *sqlparser.Where
+	switch s := stmt.(type) {
+	case *sqlparser.Update:
+		tables, where = s.TableExprs, s.Where
+	case *sqlparser.Delete:
+		tables, where = s.TableExprs, s.Where
+	case *sqlparser.Insert:
+		sel := getInsertSelect(s)
+		if sel == nil {
+			return ""
+		}
+		tables, where = sel.From, sel.Where
+		if len(sel.GroupBy) > 0 || sel.Distinct != "" {
+			// count the groups.
+			grouped := *sel
+			grouped.Where = addWhereCondition(where, cond)
+			grouped.OrderBy = nil
+			grouped.Limit = nil
+			tables = sqlparser.TableExprs{&sqlparser.AliasedTableExpr{
+				Expr: &sqlparser.Subquery{Select: &grouped},
+				As:   sqlparser.NewTableIdent("grouped"),
+			}}
+			where, cond = nil, nil
+		}
+	default:
+		return ""
+	}
+	return sqlparser.String(&sqlparser.Select{
+		SelectExprs: sqlparser.SelectExprs{&sqlparser.AliasedExpr{Expr: count}},
+		From:        tables,
+		Where:       addWhereCondition(where, cond),
+	})
+}
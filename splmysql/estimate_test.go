@@ -0,0 +1,69 @@
+package splmysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xwb1989/sqlparser"
+)
+
+func TestGetCountSQL(t *testing.T) {
+	stmt, err := parseQuery("UPDATE foo SET yo = 'hey' WHERE bar = 1 OR baz = 2")
+	assert.Nil(t, err)
+	assert.Equal(t, "select count(*) from foo where (bar = 1 or baz = 2) and (id between 1 and 10)",
+		getCountSQL(stmt, getRangeCondition("id", 1, 10), nil))
+
+	stmt, err = parseQuery("DELETE FROM foo")
+	assert.Nil(t, err)
+	assert.Equal(t, "select count(*) from foo where id between 1 and 10",
+		getCountSQL(stmt, getRangeCondition("id", 1, 10), nil))
+
+	cond, args := getKeysetRangeCondition([]string{"a", "b"}, []interface{}{1, 2}, []interface{}{3, 4}, false)
+	assert.Equal(t, "select count(*) from foo where (a, b) > (?, ?) and (a, b) <= (?, ?)",
+		getCountSQL(stmt, cond, nil))
+	assert.Equal(t, []interface{}{1, 2, 3, 4}, args)
+
+	stmt, err = parseQuery("INSERT INTO bar (id, yo) SELECT id, yo FROM foo WHERE yo = 'hey'")
+	assert.Nil(t, err)
+	assert.Equal(t, "select count(*) from foo where (yo = 'hey') and (id between 1 and 10)",
+		getCountSQL(stmt, getRangeCondition("id", 1, 10), nil))
+
+	// INSERT ... SELECT with GROUP BY counts the rows to insert.
+	stmt, err = parseQuery("INSERT INTO bar (id, c) SELECT id, COUNT(*) FROM foo GROUP BY id")
+	assert.Nil(t, err)
+	assert.Equal(t, "select count(*) from (select id, COUNT(*) from foo where id between 1 and 10 group by id) as grouped",
+		getCountSQL(stmt, getRangeCondition("id", 1, 10), nil))
+}
+
+func TestGetCountSQLMultiTable(t *testing.T) {
+	stmt, err := parseQuery("UPDATE orders o JOIN items i ON i.order_id = o.id SET o.total = o.total + i.price")
+	assert.Nil(t, err)
+	sess := &Session{
+		SplittableColumns: []string{"id"},
+		stmt:              stmt,
+		qualifier:         sqlparser.TableName{Name: sqlparser.NewTableIdent("o")},
+	}
+	// the rows of the split table are counted, not the joined rows.
+	cond := sess.qualify(getRangeCondition("id", 1, 10))
+	assert.Equal(t, "select count(distinct o.id) from orders as o join items as i on i.order_id = o.id where o.id between 1 and 10",
+		getCountSQL(stmt, cond, sess.getCountKeys()))
+
+	// single table
+	sess.qualifier = sqlparser.TableName{}
+	assert.Nil(t, sess.getCountKeys())
+}
+
+func TestEstimateDensest(t *testing.T) {
+	e := Estimate{Chunks: []ChunkEstimate{
+		{ID: 1, Rows: 10},
+		{ID: 2, Rows: 30},
+		{ID: 3, Rows: 0},
+		{ID: 4, Rows: 30},
+		{ID: 5, Rows: 20},
+	}}
+	densest := e.Densest(3)
+	assert.Equal(t, []int64{2, 4, 5}, []int64{densest[0].ID, densest[1].ID, densest[2].ID})
+	assert.Equal(t, 5, len(e.Densest(10)))
+	// original order is kept.
+	assert.Equal(t, int64(1), e.Chunks[0].ID)
+}
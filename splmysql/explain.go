@@ -0,0 +1,185 @@
+package splmysql
+
+/*
+Plan preview shows the queries of the session before executing,
+and EXPLAIN checks that sample queries scan the range of the split column.
+*/
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultExplainSamples is the default number of queries to EXPLAIN.
+const DefaultExplainSamples = 5
+
+// ExplainResult is the result of EXPLAIN of a query.
+type ExplainResult struct {
+	ID    int64
+	Range string
+	// Type is the join type, like 'range' or 'ALL'.
+	Type string
+	Key  string
+	Rows int64
+	// FullScan is true if the query scans the whole table or index, not the range.
+	FullScan bool
+	// OtherKey is true if the query uses the index which does not start with the split column.
+	OtherKey bool
+}
+
+// GetPlannedSQL returns the SQL of the first n and the last n transactions in order of the range,
+// with values embedded. If there are 2n transactions or less, all of them are returned as first.
+func (sess *Session) GetPlannedSQL(n int) (first []string, last []string) {
+	transactions := sess.getSortedTransactions()
+	for i, tx := range transactions {
+		if i < n || len(transactions) <= 2*n {
+			first = append(first, sess.getInlineSQL(tx))
+		} else if i >= len(transactions)-n {
+			last = append(last, sess.getInlineSQL(tx))
+		}
+	}
+	return first, last
+}
+
+// getSortedTransactions returns transactions in order of the range, even if they are shuffled.
+func (sess *Session) getSortedTransactions() []*Transaction {
+	sess.mutexTransactions.Lock()
+	transactions := append([]*Transaction{}, sess.transactions...)
+	sess.mutexTransactions.Unlock()
+
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].id < transactions[j].id
+	})
+	return transactions
+}
+
+// getPlannedTransactions returns transactions in order of the range.
+// If transactions are created while running with adaptive split range, it creates them
+// with the current split range, or the larger one not to exceed MaxRangeTransactions.
+func (sess *Session) getPlannedTransactions() []*Transaction {
+	transactions := sess.getSortedTransactions()
+	if len(transactions) == 0 && sess.sizer != nil {
+		first := toPosition(sess.SplittableColumnMinValue, sess.SplittableColumnUnsigned)
+		last := toPosition(sess.SplittableColumnMaxValue, sess.SplittableColumnUnsigned)
+		size := sess.GetCurrentSplitRange()
+		if countRanges(first, last, size) > MaxRangeTransactions {
+			size = minRangeSize(first, last, MaxRangeTransactions)
+		}
+		transactions = newRangeTransactions(sess.SplittableColumnMinValue, sess.SplittableColumnMaxValue,
+			sess.SplittableColumnUnsigned, size)
+	}
+	return transactions
+}
+
+// getSampleTransactions returns n transactions at even intervals, including the first and the last.
+func (sess *Session) getSampleTransactions(n int) []*Transaction {
+	return sampleTransactions(sess.getPlannedTransactions(), n)
+}
+
+func sampleTransactions(transactions []*Transaction, n int) []*Transaction {
+	if n <= 0 {
+		return nil
+	}
+	if len(transactions) <= n {
+		return transactions
+	}
+	if n == 1 {
+		return transactions[:1]
+	}
+	samples := make([]*Transaction, n)
+	for i := 0; i < n; i++ {
+		samples[i] = transactions[i*(len(transactions)-1)/(n-1)]
+	}
+	return samples
+}
+
+// ExplainSession executes EXPLAIN of n sample queries of the session.
+func (sr *Runner) ExplainSession(ctx context.Context, sess *Session, n int) (results []ExplainResult, err error) {
+	var indexes []string
+	if len(sess.SplittableColumns) > 0 {
+		info, err := sr.showCreateTable(ctx, sess.TableName)
+		if err != nil {
+			return results, err
+		}
+		indexes = getIndexNames(info, sess.SplittableColumns[0])
+	}
+
+	for _, tx := range sess.getSampleTransactions(n) {
+		query := "EXPLAIN " + sess.getInlineSQL(tx)
+		sr.tracef("Exec SQL: %s", query)
+		rows, err := sr.db.QueryContext(ctx, query)
+		if err != nil {
+			return results, err
+		}
+		result, err := scanExplain(rows, sess.getExplainTable())
+		rows.Close()
+		if err != nil {
+			return results, err
+		}
+		result.OtherKey = !result.FullScan && result.Key != "" && len(indexes) > 0 &&
+			!containsString(indexes, strings.ToLower(result.Key))
+		result.ID = tx.id
+		result.Range = sess.getRangeDescription(tx)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// getExplainTable returns the name of the split table in EXPLAIN, which is the alias in multi-table statement.
+func (sess *Session) getExplainTable() string {
+	if !sess.qualifier.IsEmpty() {
+		return sess.qualifier.Name.String()
+	}
+	return sess.TableName
+}
+
+// scanExplain returns EXPLAIN of the table. It uses the first row if no row is for the table.
+func scanExplain(rows *sql.Rows, table string) (result ExplainResult, err error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return result, err
+	}
+	first := true
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return result, err
+		}
+		r, t := parseExplain(columns, values)
+		matched := strings.EqualFold(t, table)
+		if first || matched {
+			result = r
+		}
+		if matched {
+			break
+		}
+		first = false
+	}
+	return result, rows.Err()
+}
+
+// parseExplain returns the result and the table name of a row of EXPLAIN.
+func parseExplain(columns []string, values []sql.NullString) (result ExplainResult, table string) {
+	for i, name := range columns {
+		switch strings.ToLower(name) {
+		case "table":
+			table = values[i].String
+		case "type":
+			result.Type = values[i].String
+		case "key":
+			result.Key = values[i].String
+		case "rows":
+			result.Rows, _ = strconv.ParseInt(values[i].String, 10, 64)
+		}
+	}
+	// 'ALL' is full table scan, and 'index' is full index scan.
+	result.FullScan = result.Type == "ALL" || result.Type == "index"
+	return result, table
+}
@@ -0,0 +1,148 @@
+package splmysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xwb1989/sqlparser"
+)
+
+func newTestRangeSession(t *testing.T, n int64) *Session {
+	stmt, err := parseQuery("UPDATE foo SET yo = 'hey'")
+	assert.Nil(t, err)
+	sess := &Session{
+		DBName:           "db",
+		TableName:        "foo",
+		SplittableColumn: "id",
+		SplitMode:        SplitByRange,
+		stmt:             stmt,
+	}
+	for i := int64(0); i < n; i++ {
+		sess.transactions = append(sess.transactions, &Transaction{
+			id:         i + 1,
+			rangeStart: []interface{}{i * 10},
+			rangeEnd:   []interface{}{i*10 + 9},
+		})
+	}
+	return sess
+}
+
+func TestGetPlannedSQL(t *testing.T) {
+	sess := newTestRangeSession(t, 10)
+	shuffleTransactions(sess.transactions)
+
+	first, last := sess.GetPlannedSQL(2)
+	assert.Equal(t, []string{
+		"update foo set yo = 'hey' where id between 0 and 9",
+		"update foo set yo = 'hey' where id between 10 and 19",
+	}, first)
+	assert.Equal(t, []string{
+		"update foo set yo = 'hey' where id between 80 and 89",
+		"update foo set yo = 'hey' where id between 90 and 99",
+	}, last)
+
+	// all of them
+	first, last = sess.GetPlannedSQL(5)
+	assert.Equal(t, 10, len(first))
+	assert.Equal(t, 0, len(last))
+}
+
+func TestSampleTransactions(t *testing.T) {
+	sess := newTestRangeSession(t, 10)
+	ids := func(transactions []*Transaction) (ids []int64) {
+		for _, tx := range transactions {
+			ids = append(ids, tx.id)
+		}
+		return ids
+	}
+	assert.Equal(t, []int64{1, 4, 7, 10}, ids(sampleTransactions(sess.transactions, 4)))
+	assert.Equal(t, []int64{1}, ids(sampleTransactions(sess.transactions, 1)))
+	assert.Equal(t, 10, len(sampleTransactions(sess.transactions, 20)))
+	assert.Equal(t, 0, len(sampleTransactions(sess.transactions, 0)))
+
+	// adaptive session has no transactions before running
+	adaptive := &Session{
+		SplittableColumn:         "id",
+		SplittableColumnMinValue: 5,
+		SplittableColumnMaxValue: 104,
+		sizer:                    newChunkSizer(time.Second, 10, 0),
+	}
+	samples := adaptive.getSampleTransactions(3)
+	assert.Equal(t, 3, len(samples))
+	assert.Equal(t, "id between 5 and 14", adaptive.getRangeDescription(samples[0]))
+	assert.Equal(t, "id between 95 and 104", adaptive.getRangeDescription(samples[2]))
+}
+
+func TestParseExplain(t *testing.T) {
+	columns := []string{"id", "select_type", "table", "partitions", "type", "possible_keys", "key", "key_len", "ref", "rows", "filtered", "Extra"}
+	row := func(values ...string) []sql.NullString {
+		nulls := make([]sql.NullString, len(values))
+		for i, v := range values {
+			nulls[i] = sql.NullString{String: v, Valid: v != ""}
+		}
+		return nulls
+	}
+
+	result, table := parseExplain(columns, row("1", "UPDATE", "foo", "", "range", "PRIMARY", "PRIMARY", "4", "const", "100", "100.00", "Using where"))
+	assert.Equal(t, "foo", table)
+	assert.Equal(t, "range", result.Type)
+	assert.Equal(t, "PRIMARY", result.Key)
+	assert.Equal(t, int64(100), result.Rows)
+	assert.False(t, result.FullScan)
+
+	result, _ = parseExplain(columns, row("1", "UPDATE", "foo", "", "ALL", "", "", "", "", "1000000", "100.00", "Using where"))
+	assert.True(t, result.FullScan)
+
+	result, _ = parseExplain(columns, row("1", "UPDATE", "foo", "", "index", "", "PRIMARY", "4", "", "1000000", "100.00", ""))
+	assert.True(t, result.FullScan)
+}
+
+func TestExplainSessionMultiTable(t *testing.T) {
+	stmt, err := parseQuery("UPDATE bar b JOIN foo f ON b.foo_id = f.id SET b.yo = f.yo")
+	assert.Nil(t, err)
+	sess := newTestRangeSession(t, 1)
+	sess.SplittableColumns = []string{"id"}
+	sess.SplitTable = "f"
+	sess.qualifier = sqlparser.TableName{Name: sqlparser.NewTableIdent("f")}
+	sess.stmt = stmt
+
+	columns := []string{"id", "select_type", "table", "partitions", "type", "possible_keys", "key", "key_len", "ref", "rows", "filtered", "Extra"}
+	explain := func(fooType string, fooKey string) *sql.DB {
+		return openStubDB(t, map[string]stubResult{
+			"SHOW CREATE TABLE foo": {rows: [][]driver.Value{{"foo", "CREATE TABLE `foo` (\n" +
+				"  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,\n" +
+				"  `yo` varchar(10) NOT NULL,\n" +
+				"  PRIMARY KEY (`id`),\n" +
+				"  KEY `idx_yo` (`yo`)\n" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8"}}},
+			"EXPLAIN ": {columns: columns, rows: [][]driver.Value{
+				{"1", "UPDATE", "b", nil, "ALL", nil, nil, nil, nil, "1000", "100.00", nil},
+				{"1", "SIMPLE", "f", nil, fooType, "PRIMARY,idx_yo", fooKey, "4", nil, "10", "100.00", "Using where"},
+			}},
+		})
+	}
+
+	// the row of the alias of the split table is used, not the first one.
+	sr := newRunner("db")
+	sr.db = explain("range", "PRIMARY")
+	defer sr.db.Close()
+	results, err := sr.ExplainSession(context.Background(), sess, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "range", results[0].Type)
+	assert.Equal(t, "PRIMARY", results[0].Key)
+	assert.False(t, results[0].FullScan)
+	assert.False(t, results[0].OtherKey)
+
+	// the index not starting with the split column.
+	sr.db = explain("ref", "idx_yo")
+	defer sr.db.Close()
+	results, err = sr.ExplainSession(context.Background(), sess, 1)
+	assert.Nil(t, err)
+	assert.False(t, results[0].FullScan)
+	assert.True(t, results[0].OtherKey)
+}
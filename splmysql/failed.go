@@ -0,0 +1,55 @@
+package splmysql
+
+/*
+Failed SQL export writes the queries of failed transactions,
+to inspect and replay them with mysql command.
+*/
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// WriteFailedSQL writes the SQL of failed transactions with values embedded.
+// The error of each transaction is written as the comment above the SQL.
+// It returns the number of written queries.
+func (sess *Session) WriteFailedSQL(w io.Writer) (n int, err error) {
+	transactions := sess.GetFailedTransactions()
+	if len(transactions) == 0 {
+		return 0, nil
+	}
+
+	if _, err := fmt.Fprintf(w, "-- Failed queries of %s.%s\nUSE %s;\n",
+		sess.DBName, sess.TableName, sqlparser.String(sqlparser.NewTableIdent(sess.DBName))); err != nil {
+		return 0, err
+	}
+	for _, tx := range transactions {
+		sess.mutexTransactions.Lock()
+		txErr := tx.err
+		sess.mutexTransactions.Unlock()
+
+		if _, err := fmt.Fprintf(w, "\n%s\n%s;\n",
+			failedSQLComment(tx.id, txErr), sess.getInlineSQL(tx)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// failedSQLComment returns SQL comment lines of the error.
+func failedSQLComment(id int64, err error) string {
+	message := "unknown error"
+	if err != nil {
+		message = strings.TrimSpace(err.Error())
+	}
+	lines := strings.Split(message, "\n")
+	for i, line := range lines {
+		lines[i] = "-- " + line
+	}
+	lines[0] = fmt.Sprintf("-- (%d) ERROR: %s", id, strings.TrimPrefix(lines[0], "-- "))
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,77 @@
+package splmysql
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFailedSQL(t *testing.T) {
+	stmt, err := parseQuery("UPDATE foo SET yo = 'hey' WHERE bar = 1")
+	assert.Nil(t, err)
+	sess := &Session{
+		DBName:           "db",
+		TableName:        "foo",
+		SplittableColumn: "id",
+		SplitMode:        SplitByRange,
+		stmt:             stmt,
+		transactions: []*Transaction{
+			{id: 1, rangeStart: []interface{}{int64(0)}, rangeEnd: []interface{}{int64(99)}},
+			{id: 2, rangeStart: []interface{}{int64(100)}, rangeEnd: []interface{}{int64(199)}},
+			{id: 3, rangeStart: []interface{}{int64(200)}, rangeEnd: []interface{}{int64(299)}},
+		},
+	}
+	sess.finishTransaction(sess.transactions[0], &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"})
+	sess.finishTransaction(sess.transactions[1], nil)
+	sess.finishTransaction(sess.transactions[2], errors.New("first line\nsecond line"))
+
+	var buf bytes.Buffer
+	n, err := sess.WriteFailedSQL(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, `-- Failed queries of db.foo
+USE db;
+
+-- (1) ERROR: Error 1062: Duplicate entry '1' for key 'PRIMARY'
+update foo set yo = 'hey' where (bar = 1) and (id between 0 and 99);
+
+-- (3) ERROR: first line
+-- second line
+update foo set yo = 'hey' where (bar = 1) and (id between 200 and 299);
+`, buf.String())
+}
+
+func TestWriteFailedSQLKeyset(t *testing.T) {
+	stmt, err := parseQuery("DELETE FROM foo")
+	assert.Nil(t, err)
+	sess := &Session{
+		DBName:            "db",
+		TableName:         "foo",
+		SplittableColumn:  "tenant_id,id",
+		SplittableColumns: []string{"tenant_id", "id"},
+		SplitMode:         SplitByKeyset,
+		stmt:              stmt,
+		transactions: newKeysetTransactions([][]interface{}{
+			{int64(1), int64(10)},
+			{int64(2), int64(20)},
+		}),
+	}
+	sess.finishTransaction(sess.transactions[1], errors.New("lost"))
+
+	var buf bytes.Buffer
+	n, err := sess.WriteFailedSQL(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Contains(t, buf.String(), "delete from foo where (tenant_id, id) > (1, 10) and (tenant_id, id) <= (2, 20);\n")
+
+	// nothing is written without failures
+	buf.Reset()
+	sess.finishTransaction(sess.transactions[1], nil)
+	n, err = sess.WriteFailedSQL(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, "", buf.String())
+}
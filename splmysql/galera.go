@@ -0,0 +1,190 @@
+package splmysql
+
+/*
+Galera mode keeps the write set of each transaction under the limits of Galera Cluster,
+and paces dispatching while the cluster is applying flow control.
+*/
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxFlowControlPaused is the default max fraction of time paused by flow control.
+	DefaultMaxFlowControlPaused = 0.1
+	// DefaultMaxRecvQueue is the default max length of the receive queue, same as default 'gcs.fc_limit'.
+	DefaultMaxRecvQueue = 16
+)
+
+// rowImageFactor is the number of row images in the write set of updated rows (before and after).
+const rowImageFactor = 2
+
+// errNotGalera is the error that the DB is not a node of Galera Cluster.
+var errNotGalera = errors.New("not a node of Galera Cluster, wsrep variables are not found")
+
+// getGaleraMaxSplitRange returns the max split range not to exceed 'wsrep_max_ws_rows' and 'wsrep_max_ws_size'.
+// It returns 0 if there is no limit.
+func (sr *Runner) getGaleraMaxSplitRange(ctx context.Context, table string) (maxRange int64, err error) {
+	schema, name := splitTableName(table)
+	vars, err := showGlobal(ctx, sr.db, "VARIABLES", []string{"wsrep_max_ws_rows", "wsrep_max_ws_size"})
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := vars["wsrep_max_ws_rows"]; !ok {
+		return 0, errNotGalera
+	}
+	maxWsRows, err := strconv.ParseInt(vars["wsrep_max_ws_rows"], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	maxWsSize, err := strconv.ParseInt(vars["wsrep_max_ws_size"], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	var avgRowLength sql.NullInt64
+	query := `SELECT AVG_ROW_LENGTH FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`
+	args := []interface{}{name}
+	if schema != "" {
+		query = `SELECT AVG_ROW_LENGTH FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?`
+		args = []interface{}{schema, name}
+	}
+	sr.tracef("Exec SQL: %s %v", query, args)
+	if err := sr.db.QueryRowContext(ctx, query, args...).Scan(&avgRowLength); err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	if !avgRowLength.Valid {
+		sr.warnf("[%s.%s] Galera: the average row length is unknown, wsrep_max_ws_size is not considered.", sr.DBName, table)
+	}
+
+	sr.debugf("[%s.%s] Galera: wsrep_max_ws_rows=%d, wsrep_max_ws_size=%d, avg_row_length=%d",
+		sr.DBName, table, maxWsRows, maxWsSize, avgRowLength.Int64)
+	return galeraMaxRange(maxWsRows, maxWsSize, avgRowLength.Int64), nil
+}
+
+// splitTableName returns the schema and the name of the table printed by sqlparser, without quotes,
+// like 'db' and 'order' of 'db.`order`'. The schema is empty if the table is not qualified.
+func splitTableName(table string) (schema string, name string) {
+	parts := []string{}
+	var part []rune
+	quoted := false
+	runes := []rune(table)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '`' && quoted && i+1 < len(runes) && runes[i+1] == '`':
+			// escaped backquote
+			part = append(part, r)
+			i++
+		case r == '`':
+			quoted = !quoted
+		case r == '.' && !quoted:
+			parts = append(parts, string(part))
+			part = nil
+		default:
+			part = append(part, r)
+		}
+	}
+	parts = append(parts, string(part))
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return "", parts[len(parts)-1]
+}
+
+// galeraMaxRange returns the max rows of a transaction within the write set limits.
+// 0 of any argument means no limit. It returns 0 if there is no limit.
+func galeraMaxRange(maxWsRows int64, maxWsSize int64, avgRowLength int64) (maxRange int64) {
+	maxRange = maxWsRows
+	if maxWsSize > 0 && avgRowLength > 0 {
+		bySize := maxWsSize / (avgRowLength * rowImageFactor)
+		if bySize < 1 {
+			bySize = 1
+		}
+		if maxRange == 0 || bySize < maxRange {
+			maxRange = bySize
+		}
+	}
+	return maxRange
+}
+
+// GaleraThrottler pauses dispatching while the cluster is applying flow control,
+// or the receive queue of the node is long.
+type GaleraThrottler struct {
+	db *sql.DB
+	// MaxFlowControlPaused is the max fraction of time paused by flow control since the last check.
+	MaxFlowControlPaused float64
+	// MaxRecvQueue is the max length of 'wsrep_local_recv_queue'. 0 means no limit.
+	MaxRecvQueue int64
+
+	mutex       sync.Mutex
+	lastPaused  int64
+	lastChecked time.Time
+}
+
+// NewGaleraThrottler creates GaleraThrottler which checks the DB of the Runner.
+func (sr *Runner) NewGaleraThrottler(maxFlowControlPaused float64, maxRecvQueue int64) *GaleraThrottler {
+	return &GaleraThrottler{
+		db:                   sr.db,
+		MaxFlowControlPaused: maxFlowControlPaused,
+		MaxRecvQueue:         maxRecvQueue,
+	}
+}
+
+// Check returns the reason to pause if flow control is active.
+func (t *GaleraThrottler) Check(ctx context.Context) (reason string, err error) {
+	status, err := showGlobal(ctx, t.db, "STATUS",
+		[]string{"wsrep_flow_control_paused_ns", "wsrep_local_recv_queue"})
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", nil
+		}
+		return fmt.Sprintf("cannot check Galera status: %s", err.Error()), nil
+	}
+	if _, ok := status["wsrep_local_recv_queue"]; !ok {
+		return "", errNotGalera
+	}
+	pausedNs, _ := strconv.ParseInt(status["wsrep_flow_control_paused_ns"], 10, 64)
+	recvQueue, _ := strconv.ParseInt(status["wsrep_local_recv_queue"], 10, 64)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	paused := 0.0
+	if !t.lastChecked.IsZero() {
+		paused = flowControlPaused(t.lastPaused, pausedNs, now.Sub(t.lastChecked))
+	}
+	t.lastPaused = pausedNs
+	t.lastChecked = now
+
+	return checkFlowControl(paused, recvQueue, t.MaxFlowControlPaused, t.MaxRecvQueue), nil
+}
+
+// flowControlPaused returns the fraction of time paused by flow control in elapsed,
+// from the difference of 'wsrep_flow_control_paused_ns'.
+func flowControlPaused(lastPausedNs int64, pausedNs int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 || pausedNs < lastPausedNs {
+		// status is flushed
+		return 0
+	}
+	paused := float64(pausedNs-lastPausedNs) / float64(elapsed.Nanoseconds())
+	if paused > 1 {
+		paused = 1
+	}
+	return paused
+}
+
+func checkFlowControl(paused float64, recvQueue int64, maxPaused float64, maxRecvQueue int64) string {
+	if paused > maxPaused {
+		return fmt.Sprintf("Galera flow control paused %.0f%% of time (max %.0f%%)", paused*100, maxPaused*100)
+	}
+	if maxRecvQueue > 0 && recvQueue > maxRecvQueue {
+		return fmt.Sprintf("wsrep_local_recv_queue=%d (max %d)", recvQueue, maxRecvQueue)
+	}
+	return ""
+}
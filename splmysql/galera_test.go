@@ -0,0 +1,133 @@
+package splmysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTableSessionGalera(t *testing.T) {
+	db := openStubDB(t, map[string]stubResult{
+		"SHOW GLOBAL VARIABLES": {rows: [][]driver.Value{{"wsrep_max_ws_rows", "100"}, {"wsrep_max_ws_size", "2147483648"}}},
+		"SELECT AVG_ROW_LENGTH": {rows: [][]driver.Value{{int64(64)}}, args: []driver.Value{"foo"}},
+		"SHOW CREATE TABLE foo": {rows: [][]driver.Value{{"foo", "CREATE TABLE `foo` (\n" +
+			"  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,\n" +
+			"  `yo` varchar(10) NOT NULL,\n" +
+			"  PRIMARY KEY (`id`)\n" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8"}}},
+		"SELECT MIN(id), MAX(id) FROM foo": {rows: [][]driver.Value{{"1", "1000"}}},
+	})
+	defer db.Close()
+	sr := newRunner("db")
+	sr.db = db
+	sr.UseGalera = true
+	stmt, err := parseQuery("UPDATE foo SET yo = 'hey'")
+	assert.Nil(t, err)
+
+	// split range is lowered to wsrep_max_ws_rows, not changing the Runner.
+	sess, err := sr.newTableSession(context.Background(), "UPDATE foo SET yo = 'hey'", stmt, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), sess.SplitRange)
+	assert.Equal(t, int64(10), sess.GetSessionResult().Plan)
+	assert.Equal(t, DefaultSplitRange, sr.SplitRange)
+
+	// adaptive split range never exceeds wsrep_max_ws_rows.
+	sr.TargetChunkTime = time.Second
+	sess, err = sr.newTableSession(context.Background(), "UPDATE foo SET yo = 'hey'", stmt, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), sess.sizer.getSize())
+	sess.sizer.update(100, time.Millisecond)
+	assert.Equal(t, int64(100), sess.sizer.getSize())
+	assert.Equal(t, DefaultSplitRange, sr.SplitRange)
+}
+
+func TestNewTableSessionGaleraTemporal(t *testing.T) {
+	db := openStubDB(t, map[string]stubResult{
+		"SHOW GLOBAL VARIABLES": {rows: [][]driver.Value{{"wsrep_max_ws_rows", "100"}, {"wsrep_max_ws_size", "2147483648"}}},
+		"SELECT AVG_ROW_LENGTH": {rows: [][]driver.Value{{int64(64)}}, args: []driver.Value{"access_log"}},
+		"SHOW CREATE TABLE access_log": {rows: [][]driver.Value{{"access_log", "CREATE TABLE `access_log` (\n" +
+			"  `created_at` datetime NOT NULL,\n" +
+			"  KEY `idx_created_at` (`created_at`)\n" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8"}}},
+		"SELECT MIN(created_at), MAX(created_at) FROM access_log": {rows: [][]driver.Value{{"2018-01-02 03:00:00", "2018-01-02 05:59:59"}}},
+	})
+	defer db.Close()
+	var buf bytes.Buffer
+	sr := newRunner("db")
+	sr.db = db
+	sr.Logger.Out = &buf
+	sr.UseGalera = true
+	sr.SplitInterval = time.Hour
+	stmt, err := parseQuery("DELETE FROM access_log")
+	assert.Nil(t, err)
+
+	// rows of each interval cannot be limited, so it is warned instead of lowering the split range.
+	sess, err := sr.newTableSession(context.Background(), "DELETE FROM access_log", stmt, "access_log")
+	assert.Nil(t, err)
+	assert.Equal(t, SplitByTime, sess.SplitMode)
+	assert.Equal(t, int64(3), sess.GetSessionResult().Plan)
+	assert.Contains(t, buf.String(), "rows of each interval are not limited to 100")
+	assert.NotContains(t, buf.String(), "Split range is lowered")
+}
+
+func TestGetGaleraMaxSplitRange(t *testing.T) {
+	assert.Equal(t, [2]string{"", "foo"}, splitTableNameArray("foo"))
+	assert.Equal(t, [2]string{"db", "foo"}, splitTableNameArray("db.foo"))
+	assert.Equal(t, [2]string{"", "order"}, splitTableNameArray("`order`"))
+	assert.Equal(t, [2]string{"my.db", "a`b"}, splitTableNameArray("`my.db`.`a``b`"))
+
+	// the schema and the name without quotes are used to find the average row length.
+	db := openStubDB(t, map[string]stubResult{
+		"SHOW GLOBAL VARIABLES": {rows: [][]driver.Value{{"wsrep_max_ws_rows", "1000"}, {"wsrep_max_ws_size", "12800"}}},
+		"SELECT AVG_ROW_LENGTH FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?": {
+			rows: [][]driver.Value{{int64(64)}}, args: []driver.Value{"db", "order"}},
+	})
+	defer db.Close()
+	sr := newRunner("db")
+	sr.db = db
+	maxRange, err := sr.getGaleraMaxSplitRange(context.Background(), "db.`order`")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), maxRange)
+}
+
+func splitTableNameArray(table string) [2]string {
+	schema, name := splitTableName(table)
+	return [2]string{schema, name}
+}
+
+func TestGaleraMaxRange(t *testing.T) {
+	// wsrep_max_ws_rows only
+	assert.Equal(t, int64(131072), galeraMaxRange(131072, 0, 100))
+	// no limit
+	assert.Equal(t, int64(0), galeraMaxRange(0, 0, 100))
+	// 2GB write set with 1KB rows (before and after images)
+	assert.Equal(t, int64(1048576), galeraMaxRange(0, 2147483648, 1024))
+	// lower one is used
+	assert.Equal(t, int64(131072), galeraMaxRange(131072, 2147483648, 1024))
+	assert.Equal(t, int64(5000), galeraMaxRange(131072, 1000000, 100))
+	// unknown row length
+	assert.Equal(t, int64(131072), galeraMaxRange(131072, 1000000, 0))
+	// too large rows
+	assert.Equal(t, int64(1), galeraMaxRange(0, 1000, 1000))
+}
+
+func TestFlowControlPaused(t *testing.T) {
+	assert.Equal(t, 0.5, flowControlPaused(1000000000, 1500000000, time.Second))
+	assert.Equal(t, 0.0, flowControlPaused(1000000000, 1000000000, time.Second))
+	// FLUSH STATUS resets the counter
+	assert.Equal(t, 0.0, flowControlPaused(1000000000, 100, time.Second))
+	assert.Equal(t, 1.0, flowControlPaused(0, 2000000000, time.Second))
+	assert.Equal(t, 0.0, flowControlPaused(0, 100, 0))
+}
+
+func TestCheckFlowControl(t *testing.T) {
+	assert.Equal(t, "", checkFlowControl(0.05, 3, 0.1, 16))
+	assert.Equal(t, "Galera flow control paused 50% of time (max 10%)", checkFlowControl(0.5, 3, 0.1, 16))
+	assert.Equal(t, "wsrep_local_recv_queue=20 (max 16)", checkFlowControl(0, 20, 0.1, 16))
+	// no limit of receive queue
+	assert.Equal(t, "", checkFlowControl(0, 20, 0.1, 0))
+}
@@ -0,0 +1,271 @@
+package splmysql
+
+/*
+Keyset splitting walks the key index in order and splits by key tuples.
+It is used for the tables which have no single integer column for split,
+like the table with composite Primary Key or string/binary Primary Key (UUID),
+and for row count based split of the sparse key spaces.
+Boundaries are compared by MySQL, in the collation of string columns
+and in raw bytes of binary columns.
+*/
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// SplitMode is the way to split the query.
+type SplitMode int
+
+const (
+	// SplitByRange splits by fixed width range of single integer column values.
+	SplitByRange SplitMode = iota
+	// SplitByKeyset splits by key tuples, walking the key index in order.
+	// Each range has SplitRange rows at most.
+	SplitByKeyset
+	// SplitByTime splits by fixed width interval of single temporal column values,
+	// like DATETIME, DATE or TIMESTAMP.
+	SplitByTime
+)
+
+func (mode SplitMode) String() string {
+	switch mode {
+	case SplitByRange:
+		return "range"
+	case SplitByKeyset:
+		return "keyset"
+	case SplitByTime:
+		return "time"
+	}
+	return "unknown"
+}
+
+// keyKind is the kind of key column values for keyset split.
+type keyKind int
+
+const (
+	// keyInt is integer column, scanned as int64.
+	keyInt keyKind = iota
+	// keyUint is unsigned integer column, scanned as uint64.
+	keyUint
+	// keyString is CHAR or VARCHAR column, scanned as string.
+	keyString
+	// keyBytes is BINARY or VARBINARY column, scanned as []byte.
+	keyBytes
+)
+
+// getKeyKind returns the kind of key column type, if it's usable for keyset split.
+func getKeyKind(typeName string) (keyKind, bool) {
+	typeName = strings.ToLower(strings.Trim(typeName, " "))
+	switch {
+	case strings.HasPrefix(typeName, "char(") || strings.HasPrefix(typeName, "varchar("):
+		return keyString, true
+	case strings.HasPrefix(typeName, "binary(") || strings.HasPrefix(typeName, "varbinary("):
+		return keyBytes, true
+	case isIntegerType(typeName):
+		return keyInt, true
+	}
+	return 0, false
+}
+
+func (sr *Runner) getKeyColumnsForSplit(ctx context.Context, table string) (columnNames []string, kinds []keyKind, err error) {
+	info, err := sr.showCreateTable(ctx, table)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if columnNames, kinds = parseKeysetPrimaryKeyInfo(info); len(columnNames) == 0 {
+		err = NewNoUsableColumnError(fmt.Sprintf("%s.%s", sr.DBName, table))
+		return nil, nil, err
+	}
+	return columnNames, kinds, nil
+}
+
+// getKeysetBoundaries walks the key index and returns the last key tuple of each range.
+// Rows with NULL in the key are skipped, like rows out of the range of integer split.
+func (sr *Runner) getKeysetBoundaries(ctx context.Context, table string, columnNames []string, kinds []keyKind, rows int64) (boundaries [][]interface{}, err error) {
+	columns := columnListString(columnNames)
+	descColumns := make([]string, len(columnNames))
+	notNull := make([]string, len(columnNames))
+	for i, name := range columnNames {
+		descColumns[i] = sqlparser.String(sqlparser.NewColIdent(name)) + " DESC"
+		notNull[i] = sqlparser.String(sqlparser.NewColIdent(name)) + " IS NOT NULL"
+	}
+	where := strings.Join(notNull, " AND ")
+
+	// search Max key
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT 1`,
+		columns, table, where, strings.Join(descColumns, ", "))
+	sr.tracef("Exec SQL: %s", query)
+	maxKey, err := scanKeyTuple(sr.db.QueryRowContext(ctx, query), kinds)
+	if err == sql.ErrNoRows {
+		return nil, NewNoUsableColumnError(fmt.Sprintf("%s.%s", sr.DBName, table))
+	} else if err != nil {
+		return nil, err
+	}
+
+	var lastKey []interface{}
+	for {
+		var row *sql.Row
+		if lastKey == nil {
+			query = fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT 1 OFFSET %d`,
+				columns, table, where, columns, rows-1)
+			sr.tracef("Exec SQL: %s", query)
+			row = sr.db.QueryRowContext(ctx, query)
+		} else {
+			query = fmt.Sprintf(`SELECT %s FROM %s WHERE %s AND %s > %s ORDER BY %s LIMIT 1 OFFSET %d`,
+				columns, table, where, sqlparser.String(keyExpr(columnNames)),
+				sqlparser.String(valuesExpr(lastKey, false)), columns, rows-1)
+			sr.tracef("Exec SQL: %s %v", query, lastKey)
+			row = sr.db.QueryRowContext(ctx, query, lastKey...)
+		}
+
+		key, err := scanKeyTuple(row, kinds)
+		if err == sql.ErrNoRows {
+			// the last range ends with max key.
+			boundaries = append(boundaries, maxKey)
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		boundaries = append(boundaries, key)
+		if reflect.DeepEqual(key, maxKey) {
+			break
+		}
+		lastKey = key
+	}
+	return boundaries, nil
+}
+
+func scanKeyTuple(row *sql.Row, kinds []keyKind) (key []interface{}, err error) {
+	dest := make([]interface{}, len(kinds))
+	for i, kind := range kinds {
+		switch kind {
+		case keyString:
+			dest[i] = new(string)
+		case keyBytes:
+			dest[i] = new([]byte)
+		case keyUint:
+			dest[i] = new(uint64)
+		default:
+			dest[i] = new(int64)
+		}
+	}
+	if err = row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	key = make([]interface{}, len(kinds))
+	for i, d := range dest {
+		key[i] = reflect.ValueOf(d).Elem().Interface()
+	}
+	return key, nil
+}
+
+// newKeysetTransactions creates transactions from boundaries.
+// The first transaction has no lower bound.
+func newKeysetTransactions(boundaries [][]interface{}) []*Transaction {
+	transactions := []*Transaction{}
+	var lastKey []interface{}
+	for i, key := range boundaries {
+		transactions = append(transactions, &Transaction{
+			id:         int64(i + 1),
+			rangeStart: lastKey,
+			rangeEnd:   key,
+		})
+		lastKey = key
+	}
+	return transactions
+}
+
+// columnListString returns quoted column names like 'a, b'.
+func columnListString(columnNames []string) string {
+	columns := make([]string, len(columnNames))
+	for i, name := range columnNames {
+		columns[i] = sqlparser.String(sqlparser.NewColIdent(name))
+	}
+	return strings.Join(columns, ", ")
+}
+
+// keyExpr returns column name or tuple of column names like '(a, b)'.
+func keyExpr(columnNames []string) sqlparser.Expr {
+	if len(columnNames) == 1 {
+		return &sqlparser.ColName{Name: sqlparser.NewColIdent(columnNames[0])}
+	}
+	tuple := sqlparser.ValTuple{}
+	for _, name := range columnNames {
+		tuple = append(tuple, &sqlparser.ColName{Name: sqlparser.NewColIdent(name)})
+	}
+	return tuple
+}
+
+// valuesExpr returns placeholders or tuple of placeholders like '(?, ?)'.
+// If inline is true, it returns literal values instead of placeholders.
+func valuesExpr(values []interface{}, inline bool) sqlparser.Expr {
+	exprs := sqlparser.ValTuple{}
+	for _, v := range values {
+		if inline {
+			exprs = append(exprs, literalExpr(v))
+		} else {
+			exprs = append(exprs, sqlparser.NewValArg([]byte("?")))
+		}
+	}
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+	return exprs
+}
+
+// literalExpr returns SQL literal of the boundary value.
+func literalExpr(v interface{}) sqlparser.Expr {
+	switch val := v.(type) {
+	case int64:
+		return sqlparser.NewIntVal([]byte(strconv.FormatInt(val, 10)))
+	case uint64:
+		return sqlparser.NewIntVal([]byte(strconv.FormatUint(val, 10)))
+	case []byte:
+		return sqlparser.NewHexVal([]byte(hex.EncodeToString(val)))
+	}
+	return sqlparser.NewStrVal([]byte(fmt.Sprintf("%v", v)))
+}
+
+// getKeysetRangeCondition returns keyset range condition and arguments for placeholders.
+// start is excluded and end is included. nil start means no lower bound.
+// If inline is true, values are embedded in the condition and no arguments are returned.
+func getKeysetRangeCondition(columnNames []string, start []interface{}, end []interface{}, inline bool) (sqlparser.Expr, []interface{}) {
+	var cond sqlparser.Expr
+	cond = &sqlparser.ComparisonExpr{
+		Operator: sqlparser.LessEqualStr,
+		Left:     keyExpr(columnNames),
+		Right:    valuesExpr(end, inline),
+	}
+	args := append([]interface{}{}, end...)
+	if start != nil {
+		cond = &sqlparser.AndExpr{
+			Left: &sqlparser.ComparisonExpr{
+				Operator: sqlparser.GreaterThanStr,
+				Left:     keyExpr(columnNames),
+				Right:    valuesExpr(start, inline),
+			},
+			Right: cond,
+		}
+		args = append(append([]interface{}{}, start...), end...)
+	}
+	if inline {
+		args = nil
+	}
+	return cond, args
+}
+
+// getKeysetSplittedUpdateSQL adds keyset range condition into statement AST,
+// and returns the SQL and arguments for placeholders.
+func getKeysetSplittedUpdateSQL(stmt sqlparser.Statement, columnNames []string, start []interface{}, end []interface{}) (string, []interface{}) {
+	cond, args := getKeysetRangeCondition(columnNames, start, end, false)
+	return addRangeCondition(stmt, cond), args
+}
@@ -0,0 +1,121 @@
+package splmysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xwb1989/sqlparser"
+)
+
+func TestNewKeysetTransactions(t *testing.T) {
+	boundaries := [][]interface{}{
+		{int64(1), int64(100)},
+		{int64(2), int64(50)},
+		{int64(3), int64(10)},
+	}
+	transactions := newKeysetTransactions(boundaries)
+	assert.Equal(t, 3, len(transactions))
+
+	assert.Equal(t, int64(1), transactions[0].id)
+	assert.Nil(t, transactions[0].rangeStart)
+	assert.Equal(t, []interface{}{int64(1), int64(100)}, transactions[0].rangeEnd)
+
+	assert.Equal(t, int64(2), transactions[1].id)
+	assert.Equal(t, []interface{}{int64(1), int64(100)}, transactions[1].rangeStart)
+	assert.Equal(t, []interface{}{int64(2), int64(50)}, transactions[1].rangeEnd)
+
+	assert.Equal(t, int64(3), transactions[2].id)
+	assert.Equal(t, []interface{}{int64(2), int64(50)}, transactions[2].rangeStart)
+	assert.Equal(t, []interface{}{int64(3), int64(10)}, transactions[2].rangeEnd)
+
+	assert.Equal(t, 0, len(newKeysetTransactions(nil)))
+}
+
+func TestGetKeysetSplittedUpdateSQL(t *testing.T) {
+	stmt, err := parseQuery("UPDATE foo SET yo = 'hey' WHERE hey = 'yo' OR hey = 'Yo'")
+	assert.Nil(t, err)
+
+	sql, args := getKeysetSplittedUpdateSQL(stmt, []string{"tenant_id", "id"},
+		nil, []interface{}{int64(1), int64(100)})
+	assert.Equal(t, "update foo set yo = 'hey' where (hey = 'yo' or hey = 'Yo') and ((tenant_id, id) <= (?, ?))", sql)
+	assert.Equal(t, []interface{}{int64(1), int64(100)}, args)
+
+	sql, args = getKeysetSplittedUpdateSQL(stmt, []string{"tenant_id", "id"},
+		[]interface{}{int64(1), int64(100)}, []interface{}{int64(2), int64(50)})
+	assert.Equal(t, "update foo set yo = 'hey' where (hey = 'yo' or hey = 'Yo') and ((tenant_id, id) > (?, ?) and (tenant_id, id) <= (?, ?))", sql)
+	assert.Equal(t, []interface{}{int64(1), int64(100), int64(2), int64(50)}, args)
+
+	stmt, err = parseQuery("DELETE FROM foo")
+	assert.Nil(t, err)
+	sql, args = getKeysetSplittedUpdateSQL(stmt, []string{"id"},
+		[]interface{}{int64(10)}, []interface{}{int64(20)})
+	assert.Equal(t, "delete from foo where id > ? and id <= ?", sql)
+	assert.Equal(t, []interface{}{int64(10), int64(20)}, args)
+}
+
+func TestColumnListString(t *testing.T) {
+	assert.Equal(t, "tenant_id, id", columnListString([]string{"tenant_id", "id"}))
+	assert.Equal(t, "`order`, id", columnListString([]string{"order", "id"}))
+}
+
+func TestSplitModeString(t *testing.T) {
+	assert.Equal(t, "range", SplitByRange.String())
+	assert.Equal(t, "keyset", SplitByKeyset.String())
+}
+
+func TestGetKeyKind(t *testing.T) {
+	for typeName, expected := range map[string]keyKind{
+		"bigint(20)":    keyInt,
+		"char(36)":      keyString,
+		"VARCHAR(255)":  keyString,
+		"binary(16)":    keyBytes,
+		"varbinary(64)": keyBytes,
+	} {
+		kind, ok := getKeyKind(typeName)
+		assert.True(t, ok, typeName)
+		assert.Equal(t, expected, kind, typeName)
+	}
+	for _, typeName := range []string{"text", "blob", "datetime", "decimal(10,2)"} {
+		_, ok := getKeyKind(typeName)
+		assert.False(t, ok, typeName)
+	}
+}
+
+func TestStringKeysetRangeCondition(t *testing.T) {
+	start := []interface{}{"0b7f5c1e-8f8e-4b8e-9a51-2f1c3d4e5f60"}
+	end := []interface{}{"7c9e6679-7425-40de-944b-e07fc1f90ae7"}
+	cond, args := getKeysetRangeCondition([]string{"uuid"}, start, end, false)
+	assert.Equal(t, "uuid > ? and uuid <= ?", sqlparser.String(cond))
+	assert.Equal(t, []interface{}{start[0], end[0]}, args)
+
+	cond, _ = getKeysetRangeCondition([]string{"uuid"}, []interface{}{"it's"}, end, true)
+	assert.Equal(t, "uuid > 'it\\'s' and uuid <= '7c9e6679-7425-40de-944b-e07fc1f90ae7'", sqlparser.String(cond))
+
+	binStart := []interface{}{[]byte{0x00, 0xff}}
+	binEnd := []interface{}{[]byte{0x7f, 0x01}}
+	cond, args = getKeysetRangeCondition([]string{"id"}, binStart, binEnd, false)
+	assert.Equal(t, "id > ? and id <= ?", sqlparser.String(cond))
+	assert.Equal(t, []interface{}{[]byte{0x00, 0xff}, []byte{0x7f, 0x01}}, args)
+
+	cond, _ = getKeysetRangeCondition([]string{"id"}, binStart, binEnd, true)
+	assert.Equal(t, "id > X'00ff' and id <= X'7f01'", sqlparser.String(cond))
+}
+
+func TestGetKeysetBoundariesNullable(t *testing.T) {
+	// rows with NULL are skipped, not to fail scanning the key.
+	db := openStubDB(t, map[string]stubResult{
+		"SELECT user_id FROM foo WHERE user_id IS NOT NULL ORDER BY user_id DESC LIMIT 1":     {rows: [][]driver.Value{{int64(30)}}},
+		"SELECT user_id FROM foo WHERE user_id IS NOT NULL ORDER BY user_id LIMIT 1 OFFSET 1": {rows: [][]driver.Value{{int64(10)}}},
+		"SELECT user_id FROM foo WHERE user_id IS NOT NULL AND user_id > ? ORDER BY user_id LIMIT 1 OFFSET 1": {
+			rows: [][]driver.Value{{int64(30)}}, args: []driver.Value{int64(10)}},
+	})
+	defer db.Close()
+	sr := newRunner("db")
+	sr.db = db
+
+	boundaries, err := sr.getKeysetBoundaries(context.Background(), "foo", []string{"user_id"}, []keyKind{keyInt}, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]interface{}{{int64(10)}, {int64(30)}}, boundaries)
+}
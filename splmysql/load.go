@@ -0,0 +1,164 @@
+package splmysql
+
+/*
+Load throttling checks status variables of SHOW GLOBAL STATUS,
+like pt-online-schema-change's '--max-load' and '--critical-load'.
+*/
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var statusVariableNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// ParseLoadOption parses the option like 'Threads_running=50,Innodb_row_lock_current_waits=10'.
+// ':' is also accepted as the separator of the name and the value.
+func ParseLoadOption(option string) (limits map[string]int64, err error) {
+	limits = map[string]int64{}
+	for _, item := range strings.Split(option, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(strings.Replace(item, ":", "=", 1), "=", 2)
+		if len(kv) != 2 || !statusVariableNameRegexp.MatchString(kv[0]) {
+			return nil, fmt.Errorf("invalid load option '%s', use 'Variable_name=value'", item)
+		}
+		limit, err := strconv.ParseInt(kv[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid load option '%s': %s", item, err.Error())
+		}
+		limits[kv[0]] = limit
+	}
+	return limits, nil
+}
+
+// LoadThrottler pauses dispatching while any status variable is above MaxLoad,
+// and aborts the session with CriticalLoadError if any is above CriticalLoad.
+type LoadThrottler struct {
+	db           *sql.DB
+	MaxLoad      map[string]int64
+	CriticalLoad map[string]int64
+}
+
+// NewLoadThrottler creates LoadThrottler which checks the DB of the Runner.
+func (sr *Runner) NewLoadThrottler(maxLoad map[string]int64, criticalLoad map[string]int64) *LoadThrottler {
+	return &LoadThrottler{
+		db:           sr.db,
+		MaxLoad:      maxLoad,
+		CriticalLoad: criticalLoad,
+	}
+}
+
+// Check returns the reason to pause if any status variable is above MaxLoad.
+func (t *LoadThrottler) Check(ctx context.Context) (reason string, err error) {
+	status, err := t.getStatus(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", nil
+		}
+		return fmt.Sprintf("cannot check server load: %s", err.Error()), nil
+	}
+	return checkLoad(status, t.MaxLoad, t.CriticalLoad)
+}
+
+// getStatus returns the values of status variables in MaxLoad and CriticalLoad.
+func (t *LoadThrottler) getStatus(ctx context.Context) (status map[string]int64, err error) {
+	names := []string{}
+	for _, limits := range []map[string]int64{t.MaxLoad, t.CriticalLoad} {
+		for name := range limits {
+			names = append(names, name)
+		}
+	}
+	values, err := showGlobal(ctx, t.db, "STATUS", names)
+	if err != nil {
+		return nil, err
+	}
+	status = map[string]int64{}
+	for name, value := range values {
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("status variable '%s' is not a number: %s", name, value)
+		}
+		status[name] = v
+	}
+	return status, nil
+}
+
+// showGlobal returns the values of SHOW GLOBAL STATUS or SHOW GLOBAL VARIABLES.
+func showGlobal(ctx context.Context, db *sql.DB, kind string, names []string) (values map[string]string, err error) {
+	values = map[string]string{}
+	if len(names) == 0 {
+		return values, nil
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "'" + name + "'"
+	}
+
+	query := fmt.Sprintf(`SHOW GLOBAL %s WHERE Variable_name IN (%s)`, kind, strings.Join(quoted, ", "))
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+	return values, rows.Err()
+}
+
+// checkLoad compares status with the limits, in order of the variable names.
+func checkLoad(status map[string]int64, maxLoad map[string]int64, criticalLoad map[string]int64) (reason string, err error) {
+	for _, name := range sortedLoadNames(criticalLoad) {
+		value, ok := lookupStatus(status, name)
+		if !ok {
+			return "", fmt.Errorf("unknown status variable '%s'", name)
+		}
+		if value > criticalLoad[name] {
+			return "", NewCriticalLoadError(name, value, criticalLoad[name])
+		}
+	}
+	for _, name := range sortedLoadNames(maxLoad) {
+		value, ok := lookupStatus(status, name)
+		if !ok {
+			return "", fmt.Errorf("unknown status variable '%s'", name)
+		}
+		if value > maxLoad[name] {
+			return fmt.Sprintf("%s=%d (max %d)", name, value, maxLoad[name]), nil
+		}
+	}
+	return "", nil
+}
+
+// lookupStatus finds the status variable case-insensitively, as MySQL does.
+func lookupStatus(status map[string]int64, name string) (int64, bool) {
+	if v, ok := status[name]; ok {
+		return v, true
+	}
+	for k, v := range status {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+func sortedLoadNames(limits map[string]int64) []string {
+	names := make([]string, 0, len(limits))
+	for name := range limits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,60 @@
+package splmysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLoadOption(t *testing.T) {
+	limits, err := ParseLoadOption("Threads_running=50,Innodb_row_lock_current_waits=10")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"Threads_running": 50, "Innodb_row_lock_current_waits": 10}, limits)
+
+	limits, err = ParseLoadOption("Threads_running:25, ")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"Threads_running": 25}, limits)
+
+	limits, err = ParseLoadOption("")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{}, limits)
+
+	for _, option := range []string{
+		"Threads_running",
+		"Threads_running=many",
+		"Threads_running'=50",
+		"=50",
+	} {
+		_, err = ParseLoadOption(option)
+		assert.NotNil(t, err, option)
+	}
+}
+
+func TestCheckLoad(t *testing.T) {
+	maxLoad := map[string]int64{"Threads_running": 50, "Innodb_row_lock_current_waits": 10}
+	criticalLoad := map[string]int64{"Threads_running": 100}
+
+	reason, err := checkLoad(map[string]int64{"Threads_running": 20, "Innodb_row_lock_current_waits": 0}, maxLoad, criticalLoad)
+	assert.Nil(t, err)
+	assert.Equal(t, "", reason)
+
+	reason, err = checkLoad(map[string]int64{"Threads_running": 60, "Innodb_row_lock_current_waits": 11}, maxLoad, criticalLoad)
+	assert.Nil(t, err)
+	assert.Equal(t, "Innodb_row_lock_current_waits=11 (max 10)", reason)
+
+	// status names are case-insensitive
+	reason, err = checkLoad(map[string]int64{"THREADS_RUNNING": 60, "INNODB_ROW_LOCK_CURRENT_WAITS": 0}, maxLoad, criticalLoad)
+	assert.Nil(t, err)
+	assert.Equal(t, "Threads_running=60 (max 50)", reason)
+
+	_, err = checkLoad(map[string]int64{"Threads_running": 101, "Innodb_row_lock_current_waits": 0}, maxLoad, criticalLoad)
+	critical, ok := err.(*CriticalLoadError)
+	assert.True(t, ok)
+	assert.Equal(t, "Threads_running", critical.Variable)
+	assert.Equal(t, int64(101), critical.Value)
+	assert.Equal(t, int64(100), critical.Limit)
+	assert.Equal(t, CriticalLoadErrorCode, critical.Code())
+
+	_, err = checkLoad(map[string]int64{"Threads_running": 1}, maxLoad, nil)
+	assert.EqualError(t, err, "unknown status variable 'Innodb_row_lock_current_waits'")
+}
@@ -0,0 +1,121 @@
+package splmysql
+
+/*
+Metrics exports the progress of the sessions as Prometheus metrics,
+for long-running jobs without terminal.
+*/
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "split_mysql"
+
+var metricsLabels = []string{"db", "table"}
+
+// Metrics is prometheus.Collector of the sessions handled by the Runner.
+// Counters are built from the results of the sessions at each scrape.
+type Metrics struct {
+	sr *Runner
+
+	planned      *prometheus.Desc
+	executed     *prometheus.Desc
+	succeeded    *prometheus.Desc
+	failed       *prometheus.Desc
+	retried      *prometheus.Desc
+	rowsAffected *prometheus.Desc
+	running      *prometheus.Desc
+	throttled    *prometheus.Desc
+	duration     *prometheus.HistogramVec
+}
+
+// NewMetrics creates Metrics of the Runner.
+// Add ObserveTransaction to TransactionHandlers to observe the duration of each query.
+func (sr *Runner) NewMetrics() *Metrics {
+	newDesc := func(name string, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", name), help, metricsLabels, nil)
+	}
+	return &Metrics{
+		sr:           sr,
+		planned:      newDesc("queries_planned", "Number of queries planned to execute."),
+		executed:     newDesc("queries_executed_total", "Number of queries executed."),
+		succeeded:    newDesc("queries_succeeded_total", "Number of queries succeeded."),
+		failed:       newDesc("queries_failed_total", "Number of queries failed after retries."),
+		retried:      newDesc("query_retries_total", "Number of retries of queries failed with retryable errors."),
+		rowsAffected: newDesc("rows_affected_total", "Number of rows updated or deleted."),
+		running:      newDesc("queries_running", "Number of queries running now (current parallelism)."),
+		throttled:    newDesc("throttled", "1 if dispatching queries is paused by throttlers."),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "query_duration_seconds",
+			Help:      "Duration of each query including retries.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+		}, metricsLabels),
+	}
+}
+
+// ObserveTransaction is TransactionHandler to observe the duration of each query.
+func (m *Metrics) ObserveTransaction(report TransactionReport) {
+	m.duration.WithLabelValues(report.DBName, report.TableName).Observe(report.Duration.Seconds())
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		m.planned, m.executed, m.succeeded, m.failed, m.retried, m.rowsAffected, m.running, m.throttled,
+	} {
+		ch <- desc
+	}
+	m.duration.Describe(ch)
+}
+
+// sessionMetrics is the sum of the sessions of a table.
+type sessionMetrics struct {
+	result    Result
+	running   int
+	throttled bool
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	type tableKey struct{ db, table string }
+	keys := []tableKey{}
+	tables := map[tableKey]*sessionMetrics{}
+	for _, sess := range m.sr.GetSessions() {
+		key := tableKey{sess.DBName, sess.TableName}
+		sm, ok := tables[key]
+		if !ok {
+			sm = &sessionMetrics{result: NewResult(0)}
+			tables[key] = sm
+			keys = append(keys, key)
+		}
+		sm.result.Append(sess.GetSessionResult())
+		sm.running += sess.GetRunningTransactions()
+		sm.throttled = sm.throttled || sess.GetThrottleReason() != ""
+	}
+
+	for _, key := range keys {
+		sm := tables[key]
+		throttled := 0.0
+		if sm.throttled {
+			throttled = 1
+		}
+		for _, v := range []struct {
+			desc      *prometheus.Desc
+			valueType prometheus.ValueType
+			value     float64
+		}{
+			{m.planned, prometheus.GaugeValue, float64(sm.result.Plan)},
+			{m.executed, prometheus.CounterValue, float64(sm.result.Executed)},
+			{m.succeeded, prometheus.CounterValue, float64(sm.result.Succeeded)},
+			{m.failed, prometheus.CounterValue, float64(sm.result.Failed)},
+			{m.retried, prometheus.CounterValue, float64(sm.result.Retried)},
+			{m.rowsAffected, prometheus.CounterValue, float64(sm.result.RowsAffected)},
+			{m.running, prometheus.GaugeValue, float64(sm.running)},
+			{m.throttled, prometheus.GaugeValue, throttled},
+		} {
+			ch <- prometheus.MustNewConstMetric(v.desc, v.valueType, v.value, key.db, key.table)
+		}
+	}
+	m.duration.Collect(ch)
+}
@@ -0,0 +1,56 @@
+package splmysql
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	sr := newRunner("db")
+	metrics := sr.NewMetrics()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics)
+
+	sess := &Session{DBName: "db", TableName: "foo", result: NewResult(10)}
+	sr.appendSession(sess)
+	sess.updateResult(nil, 100, 1)
+	sess.updateResult(assert.AnError, 0, 3)
+	sess.addRunning(2)
+	sess.setThrottleReason("busy")
+	metrics.ObserveTransaction(TransactionReport{DBName: "db", TableName: "foo", Duration: 30 * time.Millisecond})
+
+	// retry session of the same table
+	retrySess := &Session{DBName: "db", TableName: "foo", result: NewResult(1)}
+	sr.appendSession(retrySess)
+	retrySess.updateResult(nil, 5, 0)
+
+	server := httptest.NewServer(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+
+	for _, line := range []string{
+		`split_mysql_queries_planned{db="db",table="foo"} 11`,
+		`split_mysql_queries_executed_total{db="db",table="foo"} 3`,
+		`split_mysql_queries_succeeded_total{db="db",table="foo"} 2`,
+		`split_mysql_queries_failed_total{db="db",table="foo"} 1`,
+		`split_mysql_query_retries_total{db="db",table="foo"} 4`,
+		`split_mysql_rows_affected_total{db="db",table="foo"} 105`,
+		`split_mysql_queries_running{db="db",table="foo"} 2`,
+		`split_mysql_throttled{db="db",table="foo"} 1`,
+		`split_mysql_query_duration_seconds_bucket{db="db",table="foo",le="0.04"} 1`,
+		`split_mysql_query_duration_seconds_count{db="db",table="foo"} 1`,
+	} {
+		assert.Contains(t, string(body), line)
+	}
+}
@@ -0,0 +1,166 @@
+package splmysql
+
+/*
+Range planner of integer split column.
+Values are mapped to positions in uint64 space keeping the order, to handle
+signed values below zero and the full range of BIGINT UNSIGNED without overflow.
+SplittableColumnMinValue, SplittableColumnMaxValue and nextRangeStart keep
+the bits of uint64 values in int64 for unsigned column.
+*/
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// signBit flips the order of signed values into unsigned values.
+const signBit = uint64(1) << 63
+
+// valuePosition returns the position of the boundary value (int64 or uint64) in uint64 space.
+func valuePosition(v interface{}) uint64 {
+	switch val := v.(type) {
+	case int64:
+		return uint64(val) ^ signBit
+	case uint64:
+		return val
+	}
+	return 0
+}
+
+// toPosition returns the position of the value kept in int64.
+func toPosition(v int64, unsigned bool) uint64 {
+	if unsigned {
+		return uint64(v)
+	}
+	return uint64(v) ^ signBit
+}
+
+// positionValue returns the value of the position kept in int64.
+func positionValue(p uint64, unsigned bool) int64 {
+	if unsigned {
+		return int64(p)
+	}
+	return int64(p ^ signBit)
+}
+
+// fromPosition returns the boundary value of the position: int64, or uint64 for unsigned column.
+func fromPosition(p uint64, unsigned bool) interface{} {
+	if unsigned {
+		return p
+	}
+	return positionValue(p, false)
+}
+
+// countRanges returns the number of ranges of size from start to end positions.
+func countRanges(start uint64, end uint64, size int64) int64 {
+	if end < start || size <= 0 {
+		return 0
+	}
+	n := (end-start)/uint64(size) + 1
+	if n == 0 || n > math.MaxInt64 {
+		// overflow in the full range of uint64.
+		return math.MaxInt64
+	}
+	return int64(n)
+}
+
+// rangeSize returns the number of values from start to end, which is math.MaxInt64 at most.
+func rangeSize(start interface{}, end interface{}) int64 {
+	n := valuePosition(end) - valuePosition(start) + 1
+	if n == 0 || n > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(n)
+}
+
+// MaxRangeTransactions is the max number of transactions created before executing in range mode.
+// Larger spans are split by rows or with target chunk time, which create transactions while running.
+const MaxRangeTransactions = 1000000
+
+// newTooManyRangesError returns InvalidSplitColumnError for the range which makes more than MaxRangeTransactions.
+func newTooManyRangesError(columnName string, n int64) error {
+	return NewInvalidSplitColumnError(columnName, fmt.Sprintf(
+		"the range makes %d queries (max %d), split by rows (--split-by-rows) or with target chunk time (--target-chunk-time)",
+		n, MaxRangeTransactions))
+}
+
+// minRangeSize returns the min size of ranges from start to end, not to exceed n ranges.
+func minRangeSize(start uint64, end uint64, n int64) int64 {
+	if end < start || n <= 0 {
+		return 1
+	}
+	return int64((end-start)/uint64(n) + 1)
+}
+
+// newRangeTransactions creates transactions of size from min to max.
+// The first range starts at min, and the last range ends at max.
+func newRangeTransactions(min int64, max int64, unsigned bool, size int64) []*Transaction {
+	transactions := []*Transaction{}
+	first, last := toPosition(min, unsigned), toPosition(max, unsigned)
+	if last < first || size <= 0 {
+		return transactions
+	}
+	for id, start := int64(1), first; ; id++ {
+		end := last
+		if last-start >= uint64(size) {
+			end = start + uint64(size) - 1
+		}
+		transactions = append(transactions, &Transaction{
+			id:         id,
+			rangeStart: []interface{}{fromPosition(start, unsigned)},
+			rangeEnd:   []interface{}{fromPosition(end, unsigned)},
+		})
+		if end == last {
+			break
+		}
+		start = end + 1
+	}
+	return transactions
+}
+
+// getValueRangeCondition returns 'column BETWEEN start AND end' condition of int64 or uint64 values.
+func getValueRangeCondition(splitColumnName string, start interface{}, end interface{}) sqlparser.Expr {
+	return &sqlparser.RangeCond{
+		Operator: sqlparser.BetweenStr,
+		Left:     &sqlparser.ColName{Name: sqlparser.NewColIdent(splitColumnName)},
+		From:     literalExpr(start),
+		To:       literalExpr(end),
+	}
+}
+
+// parseRangeValue parses the value of the split column returned by MySQL, and keeps it in int64.
+func parseRangeValue(s string, unsigned bool) (int64, error) {
+	if unsigned {
+		v, err := strconv.ParseUint(s, 10, 64)
+		return int64(v), err
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// parseRangeOption parses the value of RangeMin or RangeMax with the signedness of the column.
+// It returns nil if s is empty.
+func parseRangeOption(s string, unsigned bool) (*int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if unsigned && strings.HasPrefix(strings.TrimSpace(s), "-") {
+		return nil, fmt.Errorf("'%s' must not be negative for unsigned column", s)
+	}
+	v, err := parseRangeValue(strings.TrimSpace(s), unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not valid: %s", s, err.Error())
+	}
+	return &v, nil
+}
+
+// formatValue returns the value kept in int64 as string.
+func formatValue(v int64, unsigned bool) string {
+	if unsigned {
+		return strconv.FormatUint(uint64(v), 10)
+	}
+	return strconv.FormatInt(v, 10)
+}
@@ -0,0 +1,189 @@
+package splmysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPosition(t *testing.T) {
+	// order of signed values is kept.
+	assert.Equal(t, uint64(0), toPosition(math.MinInt64, false))
+	assert.Equal(t, uint64(1)<<63-1, toPosition(-1, false))
+	assert.Equal(t, uint64(1)<<63, toPosition(0, false))
+	assert.Equal(t, uint64(math.MaxUint64), toPosition(math.MaxInt64, false))
+	assert.Equal(t, toPosition(-1, false), valuePosition(int64(-1)))
+
+	// unsigned values keep the bits in int64.
+	assert.Equal(t, uint64(math.MaxUint64), toPosition(-1, true))
+	assert.Equal(t, uint64(math.MaxUint64), valuePosition(uint64(math.MaxUint64)))
+
+	assert.Equal(t, int64(-5), fromPosition(toPosition(-5, false), false))
+	assert.Equal(t, uint64(math.MaxUint64), fromPosition(toPosition(-1, true), true))
+	assert.Equal(t, int64(math.MinInt64), positionValue(0, false))
+	assert.Equal(t, int64(-1), positionValue(math.MaxUint64, true))
+}
+
+func TestCountRanges(t *testing.T) {
+	assert.Equal(t, int64(1), countRanges(5, 5, 10))
+	assert.Equal(t, int64(10), countRanges(5, 104, 10))
+	assert.Equal(t, int64(11), countRanges(5, 105, 10))
+	assert.Equal(t, int64(0), countRanges(6, 5, 10))
+
+	// full range never overflows.
+	assert.Equal(t, int64(math.MaxInt64), countRanges(0, math.MaxUint64, 1))
+	assert.Equal(t, int64(math.MaxInt64), countRanges(0, math.MaxUint64, 2))
+	assert.Equal(t, int64(3), countRanges(0, math.MaxUint64, math.MaxInt64))
+
+	assert.Equal(t, int64(10), rangeSize(int64(-5), int64(4)))
+	assert.Equal(t, int64(math.MaxInt64), rangeSize(int64(math.MinInt64), int64(math.MaxInt64)))
+	assert.Equal(t, int64(math.MaxInt64), rangeSize(uint64(0), uint64(math.MaxUint64)))
+}
+
+func TestNewRangeTransactions(t *testing.T) {
+	rangeOf := func(transactions []*Transaction) [][]interface{} {
+		ranges := [][]interface{}{}
+		for _, tx := range transactions {
+			ranges = append(ranges, []interface{}{tx.rangeStart[0], tx.rangeEnd[0]})
+		}
+		return ranges
+	}
+
+	// starts at the real minimum, not at multiples of the range.
+	transactions := newRangeTransactions(5, 30, false, 10)
+	assert.Equal(t, [][]interface{}{
+		{int64(5), int64(14)}, {int64(15), int64(24)}, {int64(25), int64(30)},
+	}, rangeOf(transactions))
+	assert.Equal(t, int64(1), transactions[0].id)
+	assert.Equal(t, int64(3), transactions[2].id)
+
+	// signed values below zero.
+	assert.Equal(t, [][]interface{}{
+		{int64(-15), int64(-6)}, {int64(-5), int64(4)}, {int64(5), int64(5)},
+	}, rangeOf(newRangeTransactions(-15, 5, false, 10)))
+
+	// full range of signed BIGINT.
+	half := int64(1) << 62
+	assert.Equal(t, [][]interface{}{
+		{int64(math.MinInt64), int64(-half - 1)}, {int64(-half), int64(-1)},
+		{int64(0), int64(half - 1)}, {int64(half), int64(math.MaxInt64)},
+	}, rangeOf(newRangeTransactions(math.MinInt64, math.MaxInt64, false, half)))
+
+	// full range of BIGINT UNSIGNED, which max is kept as -1 in int64.
+	assert.Equal(t, [][]interface{}{
+		{uint64(0), uint64(math.MaxInt64 - 1)},
+		{uint64(math.MaxInt64), uint64(math.MaxUint64 - 2)},
+		{uint64(math.MaxUint64 - 1), uint64(math.MaxUint64)},
+	}, rangeOf(newRangeTransactions(0, -1, true, math.MaxInt64)))
+
+	// last values of BIGINT UNSIGNED.
+	assert.Equal(t, [][]interface{}{
+		{uint64(math.MaxUint64 - 2), uint64(math.MaxUint64 - 1)},
+		{uint64(math.MaxUint64), uint64(math.MaxUint64)},
+	}, rangeOf(newRangeTransactions(-3, -1, true, 2)))
+
+	assert.Equal(t, 0, len(newRangeTransactions(10, 5, false, 10)))
+}
+
+func TestUnsignedRangeCondition(t *testing.T) {
+	sess := &Session{
+		SplittableColumn:         "id",
+		SplittableColumnMinValue: 0,
+		SplittableColumnMaxValue: -1,
+		SplittableColumnUnsigned: true,
+		SplitRange:               10,
+		SplitMode:                SplitByRange,
+	}
+	tx := &Transaction{
+		id:         1,
+		rangeStart: []interface{}{uint64(math.MaxUint64 - 9)},
+		rangeEnd:   []interface{}{uint64(math.MaxUint64)},
+	}
+	assert.Equal(t, "id between 18446744073709551606 and 18446744073709551615", sess.getRangeDescription(tx))
+
+	min, max := sess.GetSplittableColumnRange()
+	assert.Equal(t, uint64(0), min)
+	assert.Equal(t, uint64(math.MaxUint64), max)
+}
+
+func TestNextTransactionAdaptiveFullRange(t *testing.T) {
+	sess := &Session{
+		SplittableColumn:         "id",
+		SplittableColumnMinValue: -2,
+		SplittableColumnMaxValue: -1,
+		SplittableColumnUnsigned: true,
+		SplitRange:               1,
+		sizer:                    newChunkSizer(time.Second, 1, 0),
+		nextRangeStart:           -2,
+		result:                   NewResult(2),
+	}
+
+	tx := sess.nextTransaction()
+	assert.Equal(t, []interface{}{uint64(math.MaxUint64 - 1)}, tx.rangeStart)
+	assert.Equal(t, []interface{}{uint64(math.MaxUint64 - 1)}, tx.rangeEnd)
+	assert.Equal(t, int64(2), sess.GetSessionResult().Plan)
+	assert.Equal(t, []string{
+		"id between 18446744073709551614 and 18446744073709551614",
+		"id between 18446744073709551615 and 18446744073709551615",
+	}, sess.GetUnprocessedRanges())
+
+	tx = sess.nextTransaction()
+	assert.Equal(t, []interface{}{uint64(math.MaxUint64)}, tx.rangeStart)
+	assert.Equal(t, []interface{}{uint64(math.MaxUint64)}, tx.rangeEnd)
+	assert.Nil(t, sess.nextTransaction())
+}
+
+func TestParseRangeOption(t *testing.T) {
+	v, err := parseRangeOption("", false)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	v, err = parseRangeOption("-100", false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-100), *v)
+
+	// BIGINT UNSIGNED above MaxInt64 keeps the bits.
+	v, err = parseRangeOption("18446744073709551615", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "18446744073709551615", formatValue(*v, true))
+
+	_, err = parseRangeOption("18446744073709551615", false)
+	assert.NotNil(t, err)
+	_, err = parseRangeOption("-1", true)
+	assert.EqualError(t, err, "'-1' must not be negative for unsigned column")
+	_, err = parseRangeOption("abc", false)
+	assert.NotNil(t, err)
+}
+
+func TestMaxRangeTransactions(t *testing.T) {
+	assert.Equal(t, int64(10), minRangeSize(1, 100, 10))
+	assert.Equal(t, int64(11), minRangeSize(1, 101, 10))
+	assert.Equal(t, int64(1), minRangeSize(1, 5, 10))
+	assert.Equal(t, int64(MaxRangeTransactions), countRanges(0, math.MaxUint64, minRangeSize(0, math.MaxUint64, MaxRangeTransactions)))
+
+	// too many ranges are refused before creating them.
+	db := openStubDB(t, map[string]stubResult{
+		"SHOW CREATE TABLE foo": {rows: [][]driver.Value{{"foo", "CREATE TABLE `foo` (\n" +
+			"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,\n" +
+			"  PRIMARY KEY (`id`)\n" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8"}}},
+		"SELECT MIN(id), MAX(id) FROM foo": {rows: [][]driver.Value{{"1", "18446744073709551615"}}},
+	})
+	defer db.Close()
+	sr := newRunner("db")
+	sr.db = db
+	stmt, err := parseQuery("DELETE FROM foo")
+	assert.Nil(t, err)
+	_, err = sr.newTableSession(context.Background(), "DELETE FROM foo", stmt, "foo")
+	assert.IsType(t, &InvalidSplitColumnError{}, err)
+
+	// adaptive split range creates transactions while running.
+	sr.TargetChunkTime = time.Second
+	sess, err := sr.newTableSession(context.Background(), "DELETE FROM foo", stmt, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(sess.transactions))
+}
@@ -0,0 +1,250 @@
+package splmysql
+
+/*
+Replica lag throttling checks replication lag of replicas,
+with SHOW REPLICA STATUS or the heartbeat table updated by pt-heartbeat.
+*/
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// DefaultMaxLag is the default max replication lag to continue dispatching.
+const DefaultMaxLag = time.Second
+
+// errReplicationNotRunning is the error that SQL thread of the replica is not running.
+var errReplicationNotRunning = errors.New("replication is not running")
+
+// Replica is the replica server to check replication lag.
+type Replica struct {
+	// Name is the address of the replica used in logs.
+	Name string
+	db   *sql.DB
+}
+
+// NewReplica makes DB connection to the replica with DSN of go-sql-driver/mysql.
+func NewReplica(dsn string) (*Replica, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return &Replica{Name: cfg.Addr, db: db}, nil
+}
+
+// NewReplicaByOptions makes DB connection to the replica with options.
+func NewReplicaByOptions(addr string, user string, pwd string) (*Replica, error) {
+	return NewReplica(fmt.Sprintf("%s:%s@tcp(%s)/", user, pwd, addr))
+}
+
+// Close disconnects the DB connection.
+func (r *Replica) Close() {
+	r.db.Close()
+}
+
+// getLag returns replication lag of the replica.
+// If heartbeatTable is not empty, it's calculated from the latest 'ts' of the table,
+// which is written in UTC if utc is true, or in the time zone of the replica.
+// With multi-source replication, it returns the max lag of all channels.
+func (r *Replica) getLag(ctx context.Context, heartbeatTable string, utc bool) (lag time.Duration, err error) {
+	if heartbeatTable != "" {
+		now := "NOW(6)"
+		if utc {
+			now = "UTC_TIMESTAMP(6)"
+		}
+		var usec sql.NullInt64
+		query := fmt.Sprintf(`SELECT TIMESTAMPDIFF(MICROSECOND, MAX(ts), %s) FROM %s`, now, heartbeatTable)
+		if err := r.db.QueryRowContext(ctx, query).Scan(&usec); err != nil {
+			return 0, err
+		}
+		if !usec.Valid {
+			return 0, fmt.Errorf("no heartbeat in %s", heartbeatTable)
+		}
+		return time.Duration(usec.Int64) * time.Microsecond, nil
+	}
+
+	// SHOW REPLICA STATUS is available on MySQL 8.0.22 or later.
+	rows, err := r.db.QueryContext(ctx, `SHOW REPLICA STATUS`)
+	if err != nil {
+		rows, err = r.db.QueryContext(ctx, `SHOW SLAVE STATUS`)
+		if err != nil {
+			return 0, err
+		}
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	found := false
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return 0, err
+		}
+		// any channel not running makes the lag unknown.
+		channelLag, err := parseSecondsBehind(columns, values)
+		if err != nil {
+			return 0, err
+		}
+		if channelLag > lag {
+			lag = channelLag
+		}
+		found = true
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, errors.New("not a replica")
+	}
+	return lag, nil
+}
+
+// parseSecondsBehind returns Seconds_Behind_Source (or Seconds_Behind_Master) of the replica status.
+func parseSecondsBehind(columns []string, values []sql.NullString) (lag time.Duration, err error) {
+	for i, name := range columns {
+		if name != "Seconds_Behind_Source" && name != "Seconds_Behind_Master" {
+			continue
+		}
+		if !values[i].Valid {
+			return 0, errReplicationNotRunning
+		}
+		sec, err := strconv.ParseInt(values[i].String, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(sec) * time.Second, nil
+	}
+	return 0, errors.New("no Seconds_Behind_Source in replica status")
+}
+
+// ReplicaLagThrottler pauses dispatching while replication lag of any replica is above MaxLag.
+type ReplicaLagThrottler struct {
+	Replicas []*Replica
+	MaxLag   time.Duration
+	// HeartbeatTable is the table updated by pt-heartbeat, like 'percona.heartbeat'.
+	// If it's empty, replication lag is checked with SHOW REPLICA STATUS.
+	HeartbeatTable string
+	// HeartbeatUTC is true if pt-heartbeat runs with --utc.
+	// Otherwise 'ts' is compared with NOW(6), the time in the time zone of the replica.
+	HeartbeatUTC bool
+}
+
+// Check returns the reason to pause if replication lag of any replica is above MaxLag.
+// It also pauses if it cannot check the replica, not to go ahead blindly.
+func (t *ReplicaLagThrottler) Check(ctx context.Context) (reason string, err error) {
+	for _, r := range t.Replicas {
+		lag, err := r.getLag(ctx, t.HeartbeatTable, t.HeartbeatUTC)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", nil
+			}
+			return fmt.Sprintf("cannot check replication lag of %s: %s", r.Name, err.Error()), nil
+		}
+		if lag > t.MaxLag {
+			return fmt.Sprintf("replication lag of %s is %s (max %s)", r.Name, lag, t.MaxLag), nil
+		}
+	}
+	return "", nil
+}
+
+// DiscoverReplicas finds the replicas of the DB and returns their addresses.
+// It uses SHOW REPLICAS, which lists the replicas with 'report_host'.
+// If no replica is found, it uses the processlist of binlog dump threads,
+// and port is used as the port of them because processlist doesn't know it.
+func (sr *Runner) DiscoverReplicas(ctx context.Context, port int) (addrs []string, err error) {
+	// SHOW REPLICAS is available on MySQL 8.0.22 or later.
+	rows, err := sr.db.QueryContext(ctx, `SHOW REPLICAS`)
+	if err != nil {
+		rows, err = sr.db.QueryContext(ctx, `SHOW SLAVE HOSTS`)
+		if err != nil {
+			return nil, err
+		}
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if addr := parseReplicaHost(columns, values); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(addrs) > 0 {
+		return addrs, nil
+	}
+
+	query := `SELECT HOST FROM information_schema.PROCESSLIST WHERE COMMAND LIKE 'Binlog Dump%'`
+	sr.tracef("Exec SQL: %s", query)
+	rows, err = sr.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var host string
+		if err := rows.Scan(&host); err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, processlistHostToAddr(host, port))
+	}
+	return addrs, rows.Err()
+}
+
+// parseReplicaHost returns the address of the replica in SHOW REPLICAS.
+// It returns empty string if the replica doesn't report its host.
+func parseReplicaHost(columns []string, values []sql.NullString) string {
+	var host, port string
+	for i, name := range columns {
+		switch name {
+		case "Host":
+			host = values[i].String
+		case "Port":
+			port = values[i].String
+		}
+	}
+	if host == "" || port == "" {
+		return ""
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// processlistHostToAddr replaces the client port in processlist with port.
+func processlistHostToAddr(host string, port int) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
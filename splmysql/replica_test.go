@@ -0,0 +1,94 @@
+package splmysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSecondsBehind(t *testing.T) {
+	columns := []string{"Replica_IO_State", "Source_Host", "Seconds_Behind_Source"}
+	lag, err := parseSecondsBehind(columns, []sql.NullString{
+		{String: "Waiting for source to send event", Valid: true},
+		{String: "db1", Valid: true},
+		{String: "12", Valid: true},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 12*time.Second, lag)
+
+	// MySQL 5.7 or before
+	lag, err = parseSecondsBehind([]string{"Seconds_Behind_Master"}, []sql.NullString{{String: "0", Valid: true}})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), lag)
+
+	// SQL thread is stopped
+	_, err = parseSecondsBehind(columns, []sql.NullString{{}, {}, {}})
+	assert.Equal(t, errReplicationNotRunning, err)
+
+	_, err = parseSecondsBehind([]string{"Source_Host"}, []sql.NullString{{String: "db1", Valid: true}})
+	assert.NotNil(t, err)
+}
+
+func TestParseReplicaHost(t *testing.T) {
+	columns := []string{"Server_Id", "Host", "Port", "Source_Id", "Replica_UUID"}
+	assert.Equal(t, "db2:3307", parseReplicaHost(columns, []sql.NullString{
+		{String: "2", Valid: true}, {String: "db2", Valid: true}, {String: "3307", Valid: true}, {String: "1", Valid: true}, {},
+	}))
+	// report_host is not set
+	assert.Equal(t, "", parseReplicaHost(columns, []sql.NullString{
+		{String: "2", Valid: true}, {String: "", Valid: true}, {String: "3306", Valid: true}, {String: "1", Valid: true}, {},
+	}))
+}
+
+func TestProcesslistHostToAddr(t *testing.T) {
+	assert.Equal(t, "10.0.0.2:3306", processlistHostToAddr("10.0.0.2:51234", 3306))
+	assert.Equal(t, "[fd00::2]:3306", processlistHostToAddr("[fd00::2]:51234", 3306))
+	assert.Equal(t, "localhost:3307", processlistHostToAddr("localhost", 3307))
+}
+
+func TestNewReplica(t *testing.T) {
+	r, err := NewReplica("user:pass@tcp(db2:3306)/")
+	assert.Nil(t, err)
+	defer r.Close()
+	assert.Equal(t, "db2:3306", r.Name)
+
+	_, err = NewReplica("user:pass@tcp(db2:3306)")
+	assert.NotNil(t, err)
+}
+
+func TestGetLag(t *testing.T) {
+	columns := []string{"Channel_Name", "Seconds_Behind_Source"}
+	db := openStubDB(t, map[string]stubResult{
+		"SHOW REPLICA STATUS": {columns: columns, rows: [][]driver.Value{{"ch1", "3"}, {"ch2", "12"}, {"ch3", "0"}}},
+		"SELECT TIMESTAMPDIFF(MICROSECOND, MAX(ts), NOW(6)) FROM percona.heartbeat":           {rows: [][]driver.Value{{int64(1500000)}}},
+		"SELECT TIMESTAMPDIFF(MICROSECOND, MAX(ts), UTC_TIMESTAMP(6)) FROM percona.heartbeat": {rows: [][]driver.Value{{int64(2500000)}}},
+	})
+	defer db.Close()
+	r := &Replica{Name: "db2:3306", db: db}
+
+	// the max lag of all channels
+	lag, err := r.getLag(context.Background(), "", false)
+	assert.Nil(t, err)
+	assert.Equal(t, 12*time.Second, lag)
+
+	// heartbeat in the time zone of the replica, or in UTC
+	lag, err = r.getLag(context.Background(), "percona.heartbeat", false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1500*time.Millisecond, lag)
+	lag, err = r.getLag(context.Background(), "percona.heartbeat", true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2500*time.Millisecond, lag)
+
+	// any channel not running
+	db = openStubDB(t, map[string]stubResult{
+		"SHOW REPLICA STATUS": {columns: columns, rows: [][]driver.Value{{"ch1", "3"}, {"ch2", nil}}},
+	})
+	defer db.Close()
+	r = &Replica{Name: "db2:3306", db: db}
+	_, err = r.getLag(context.Background(), "", false)
+	assert.Equal(t, errReplicationNotRunning, err)
+}
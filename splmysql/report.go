@@ -0,0 +1,68 @@
+package splmysql
+
+/*
+Transaction report is the result of each executed transaction,
+for chunk logs and monitoring.
+*/
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// TransactionReport is the result of an executed transaction.
+type TransactionReport struct {
+	Time         time.Time     `json:"time"`
+	DBName       string        `json:"db_name"`
+	TableName    string        `json:"table_name"`
+	ID           int64         `json:"id"`
+	Range        string        `json:"range"`
+	RangeStart   []interface{} `json:"range_start"`
+	RangeEnd     []interface{} `json:"range_end"`
+	RowsAffected int64         `json:"rows_affected"`
+	Duration     time.Duration `json:"duration_ns"`
+	// Attempts is the number of executions of the transaction, including retries.
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// TransactionHandler is the function called when each transaction finished.
+type TransactionHandler func(report TransactionReport)
+
+func (sess *Session) newTransactionReport(tx *Transaction, rowsAffected int64, elapsed time.Duration, attempts int, err error) TransactionReport {
+	report := TransactionReport{
+		Time:         time.Now(),
+		DBName:       sess.DBName,
+		TableName:    sess.TableName,
+		ID:           tx.id,
+		Range:        sess.getRangeDescription(tx),
+		RangeStart:   tx.rangeStart,
+		RangeEnd:     tx.rangeEnd,
+		RowsAffected: rowsAffected,
+		Duration:     elapsed,
+		Attempts:     attempts,
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report
+}
+
+func (sr *Runner) handleTransaction(report TransactionReport) {
+	for _, handler := range sr.TransactionHandlers {
+		handler(report)
+	}
+}
+
+// NewChunkLogHandler returns TransactionHandler which writes each report as a line of JSON.
+func NewChunkLogHandler(w io.Writer) TransactionHandler {
+	var mutex sync.Mutex
+	encoder := json.NewEncoder(w)
+	return func(report TransactionReport) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		encoder.Encode(report)
+	}
+}
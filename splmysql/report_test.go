@@ -0,0 +1,55 @@
+package splmysql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTransactionReport(t *testing.T) {
+	sess := &Session{
+		DBName:           "db",
+		TableName:        "foo",
+		SplittableColumn: "id",
+		SplitMode:        SplitByRange,
+	}
+	tx := &Transaction{id: 2, rangeStart: []interface{}{int64(100)}, rangeEnd: []interface{}{int64(199)}}
+
+	report := sess.newTransactionReport(tx, 42, time.Second, 1, nil)
+	assert.Equal(t, int64(2), report.ID)
+	assert.Equal(t, "id between 100 and 199", report.Range)
+	assert.Equal(t, int64(42), report.RowsAffected)
+	assert.Equal(t, "", report.Error)
+
+	report = sess.newTransactionReport(tx, 0, time.Second, 4, errors.New("Deadlock found"))
+	assert.Equal(t, 4, report.Attempts)
+	assert.Equal(t, "Deadlock found", report.Error)
+}
+
+func TestChunkLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	sr := newRunner("db")
+	sr.TransactionHandlers = []TransactionHandler{NewChunkLogHandler(&buf)}
+
+	sr.handleTransaction(TransactionReport{ID: 1, Range: "id between 0 and 99", RowsAffected: 10, Duration: time.Millisecond, Attempts: 1})
+	sr.handleTransaction(TransactionReport{ID: 2, Range: "id between 100 and 199", Attempts: 2, Error: "lost"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+
+	var line map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &line))
+	assert.Equal(t, "id between 0 and 99", line["range"])
+	assert.Equal(t, float64(10), line["rows_affected"])
+	assert.Equal(t, float64(time.Millisecond), line["duration_ns"])
+	assert.Nil(t, line["error"])
+
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &line))
+	assert.Equal(t, float64(2), line["attempts"])
+	assert.Equal(t, "lost", line["error"])
+}
@@ -3,15 +3,17 @@ package splmysql
 // Result is struct of SQL execution result.
 type Result struct {
 	// Plan is number of estimated to execute
-	Plan int64
+	Plan int64 `json:"plan"`
 	// Executed is number of queries executed to DB.
-	Executed int64
+	Executed int64 `json:"executed"`
 	// Succeeded is number of queries succeeded.
-	Succeeded int64
+	Succeeded int64 `json:"succeeded"`
 	// Failed is number of queries failed.
-	Failed int64
+	Failed int64 `json:"failed"`
 	// RowsAffected is number of rows updated.
-	RowsAffected int64
+	RowsAffected int64 `json:"rows_affected"`
+	// Retried is number of retries of queries failed with retryable errors.
+	Retried int64 `json:"retried"`
 	// LastInsertID is auto_increment last id. Not used in this implementation.
 	//LastInsertID int64
 }
@@ -24,6 +26,7 @@ func NewResult(plan int64) Result {
 		Succeeded:    0,
 		Failed:       0,
 		RowsAffected: 0,
+		Retried:      0,
 	}
 }
 
@@ -35,6 +38,7 @@ func (r *Result) Copy() Result {
 		Succeeded:    r.Succeeded,
 		Failed:       r.Failed,
 		RowsAffected: r.RowsAffected,
+		Retried:      r.Retried,
 	}
 }
 
@@ -45,4 +49,5 @@ func (r *Result) Append(result Result) {
 	r.Succeeded += result.Succeeded
 	r.Failed += result.Failed
 	r.RowsAffected += result.RowsAffected
+	r.Retried += result.Retried
 }
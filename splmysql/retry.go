@@ -0,0 +1,124 @@
+package splmysql
+
+/*
+Retry policy retries the transactions failed with retryable errors,
+like deadlock or lost connection, with exponential backoff and jitter.
+*/
+
+import (
+	"context"
+	"database/sql/driver"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	// DefaultMaxRetry is the default max number of retries of each transaction.
+	DefaultMaxRetry = 3
+	// DefaultInitialBackoff is the default wait time before the first retry.
+	DefaultInitialBackoff = 100 * time.Millisecond
+	// DefaultMaxBackoff is the default upper limit of the wait time before retry.
+	DefaultMaxBackoff = 10 * time.Second
+)
+
+// MySQL error numbers which are retryable.
+const (
+	errLockWaitTimeout = 1205
+	errLockDeadlock    = 1213
+)
+
+// RetryPolicy is the policy to retry failed transactions.
+type RetryPolicy struct {
+	// MaxRetry is the max number of retries of each transaction. 0 means no retry.
+	MaxRetry int
+	// InitialBackoff is the wait time before the first retry. It doubles for each retry.
+	InitialBackoff time.Duration
+	// MaxBackoff is the upper limit of the wait time.
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy returns the default retry policy.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetry:       DefaultMaxRetry,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+	}
+}
+
+// Backoff returns the wait time before the retry-th retry (starts with 1).
+// It's between a half and all of the exponential backoff, not to retry at once.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1))
+}
+
+// IsRetryableError returns true if the error is deadlock, lock wait timeout or lost connection.
+// Other errors like syntax error or duplicate key fail without retry.
+func IsRetryableError(err error) bool {
+	if e, ok := err.(*mysql.MySQLError); ok {
+		return e.Number == errLockDeadlock || e.Number == errLockWaitTimeout
+	}
+	return isConnectionError(err)
+}
+
+// isConnectionError returns true if the error is lost connection.
+func isConnectionError(err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return err == driver.ErrBadConn || err == mysql.ErrInvalidConn
+}
+
+// commitStateUnknownError is lost connection while committing.
+// It's not retried, because the transaction may have been committed.
+type commitStateUnknownError struct {
+	cause error
+}
+
+func (e *commitStateUnknownError) Error() string {
+	return "lost connection while committing, the commit state is unknown: " + e.cause.Error()
+}
+
+// commitError returns the error of COMMIT, which is not retryable if the connection is lost.
+func commitError(err error) error {
+	if isConnectionError(err) {
+		return &commitStateUnknownError{cause: err}
+	}
+	return err
+}
+
+// doUpdateWithRetry executes the query and retries it with the retry policy.
+// It doesn't retry after ctx is done.
+func (sr *Runner) doUpdateWithRetry(ctx context.Context, execCtx context.Context, sql string, args ...interface{}) (rowsAffected int64, attempts int, err error) {
+	for {
+		attempts++
+		rowsAffected, _, err = sr.doUpdateContext(execCtx, sql, args...)
+		if err == nil || !IsRetryableError(err) || attempts > sr.RetryPolicy.MaxRetry || ctx.Err() != nil {
+			return rowsAffected, attempts, err
+		}
+
+		backoff := sr.RetryPolicy.Backoff(attempts)
+		sr.warnf("Retry %d/%d after %s: %s", attempts, sr.RetryPolicy.MaxRetry, backoff, err.Error())
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return rowsAffected, attempts, err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package splmysql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{MaxRetry: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for i := 0; i < 100; i++ {
+		b := p.Backoff(1)
+		assert.True(t, b >= 50*time.Millisecond && b <= 100*time.Millisecond, b)
+		b = p.Backoff(3)
+		assert.True(t, b >= 200*time.Millisecond && b <= 400*time.Millisecond, b)
+		b = p.Backoff(10)
+		assert.True(t, b >= 500*time.Millisecond && b <= time.Second, b)
+	}
+
+	assert.Equal(t, time.Duration(0), RetryPolicy{}.Backoff(1))
+}
+
+func TestIsRetryableError(t *testing.T) {
+	assert.True(t, IsRetryableError(&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}))
+	assert.True(t, IsRetryableError(&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}))
+	assert.True(t, IsRetryableError(driver.ErrBadConn))
+	assert.True(t, IsRetryableError(mysql.ErrInvalidConn))
+	assert.True(t, IsRetryableError(&net.OpError{Op: "read", Err: errors.New("connection reset by peer")}))
+
+	assert.False(t, IsRetryableError(nil))
+	assert.False(t, IsRetryableError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}))
+	assert.False(t, IsRetryableError(&mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"}))
+	assert.False(t, IsRetryableError(errors.New("unknown")))
+
+	// lost connection while committing is not retried, the transaction may have been committed.
+	err := commitError(driver.ErrBadConn)
+	assert.False(t, IsRetryableError(err))
+	assert.EqualError(t, err, "lost connection while committing, the commit state is unknown: "+driver.ErrBadConn.Error())
+	assert.False(t, IsRetryableError(commitError(&net.OpError{Op: "read", Err: errors.New("connection reset by peer")})))
+	// other errors of COMMIT are kept as they are.
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+	assert.Equal(t, deadlock, commitError(deadlock))
+	assert.True(t, IsRetryableError(commitError(deadlock)))
+}
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	sr := newRunner("db")
+	assert.Equal(t, DefaultRetryPolicy(), sr.RetryPolicy)
+	assert.Equal(t, DefaultMaxRetry, sr.RetryPolicy.MaxRetry)
+}
@@ -1,6 +1,11 @@
 package splmysql
 
-import "sync"
+import (
+	"sync"
+	"time"
+
+	"github.com/xwb1989/sqlparser"
+)
 
 // Session is a data of splmysql parallel execution
 type Session struct {
@@ -8,21 +13,221 @@ type Session struct {
 	DBName                   string
 	TableName                string
 	SplittableColumn         string
+	SplittableColumns        []string
 	SplittableColumnMinValue int64
 	SplittableColumnMaxValue int64
+	SplittableColumnUnsigned bool
+	SplittableColumnMinTime  time.Time
+	SplittableColumnMaxTime  time.Time
 	SplitRange               int64
+	SplitInterval            time.Duration
+	SplitMode                SplitMode
+	SplitTable               string
+	stmt                     sqlparser.Statement
 	transactions             []*Transaction
 	result                   Result
 	mutexResult              sync.RWMutex
+	mutexTransactions        sync.Mutex
+
+	// dispatched is the number of transactions dispatched by nextTransaction.
+	dispatched int
+	// sizer creates transactions on demand with adaptive range, if it's not nil.
+	sizer *chunkSizer
+	// nextRangeStart is the start value of the next transaction created by sizer.
+	nextRangeStart int64
+	// sizerDone is true when sizer reached the max value.
+	sizerDone bool
+	// nextID is the id of the next transaction created by sizer, 0 if not decided yet.
+	nextID int64
+	// throttleReason is the reason why dispatching is paused by throttlers.
+	throttleReason string
+	// running is the number of transactions running now.
+	running int
+	// qualifier qualifies the split columns with SplitTable in multi-table UPDATE.
+	qualifier sqlparser.TableName
+	// checkpointFile is the path of the file to save the state after each committed transaction.
+	checkpointFile  string
+	mutexCheckpoint sync.Mutex
 }
 
 // Transaction is single transaction data, equals to single SQL
 type Transaction struct {
-	id         int64
-	completed  bool
-	failed     bool
-	rangeStart int64
-	rangeEnd   int64
+	id        int64
+	completed bool
+	failed    bool
+	// rangeStart and rangeEnd are the boundary values of splittable columns.
+	// SplitByRange includes both of them, SplitByKeyset excludes rangeStart.
+	rangeStart []interface{}
+	rangeEnd   []interface{}
+	// err is the last error of the transaction.
+	err error
+}
+
+// getRangeCondition returns the range condition of the transaction and arguments for placeholders.
+// If inline is true, values are embedded in the condition.
+func (sess *Session) getRangeCondition(tx *Transaction, inline bool) (cond sqlparser.Expr, args []interface{}) {
+	switch sess.SplitMode {
+	case SplitByKeyset:
+		cond, args = getKeysetRangeCondition(sess.SplittableColumns, tx.rangeStart, tx.rangeEnd, inline)
+	case SplitByTime:
+		cond, args = getTimeRangeCondition(sess.SplittableColumn, tx.rangeStart[0].(time.Time), tx.rangeEnd[0].(time.Time), inline)
+	default:
+		cond = getValueRangeCondition(sess.SplittableColumn, tx.rangeStart[0], tx.rangeEnd[0])
+	}
+	return sess.qualify(cond), args
+}
+
+// qualify qualifies the columns in the condition with the table split by, in multi-table UPDATE.
+func (sess *Session) qualify(cond sqlparser.Expr) sqlparser.Expr {
+	if sess.qualifier.IsEmpty() {
+		return cond
+	}
+	return qualifyColumns(cond, sess.qualifier)
+}
+
+// getSplittedSQL returns the SQL and its arguments executed by the transaction.
+func (sess *Session) getSplittedSQL(tx *Transaction) (string, []interface{}) {
+	cond, args := sess.getRangeCondition(tx, false)
+	return addRangeCondition(sess.stmt, cond), args
+}
+
+// getInlineSQL returns the SQL executed by the transaction with values embedded.
+func (sess *Session) getInlineSQL(tx *Transaction) string {
+	cond, _ := sess.getRangeCondition(tx, true)
+	return addRangeCondition(sess.stmt, cond)
+}
+
+// getRangeDescription returns the range condition of the transaction with values embedded.
+func (sess *Session) getRangeDescription(tx *Transaction) string {
+	cond, _ := sess.getRangeCondition(tx, true)
+	return sqlparser.String(cond)
+}
+
+// GetCurrentSplitRange returns the split range used by the next transaction.
+// It changes while running if the session uses adaptive split range.
+func (sess *Session) GetCurrentSplitRange() int64 {
+	if sess.sizer == nil {
+		return sess.SplitRange
+	}
+	return sess.sizer.getSize()
+}
+
+// GetThrottleReason returns the reason why dispatching is paused, or empty string if it's not paused.
+func (sess *Session) GetThrottleReason() string {
+	sess.mutexResult.RLock()
+	defer sess.mutexResult.RUnlock()
+	return sess.throttleReason
+}
+
+func (sess *Session) setThrottleReason(reason string) {
+	sess.mutexResult.Lock()
+	defer sess.mutexResult.Unlock()
+	sess.throttleReason = reason
+}
+
+// GetRunningTransactions returns the number of transactions running now.
+func (sess *Session) GetRunningTransactions() int {
+	sess.mutexResult.RLock()
+	defer sess.mutexResult.RUnlock()
+	return sess.running
+}
+
+func (sess *Session) addRunning(delta int) {
+	sess.mutexResult.Lock()
+	defer sess.mutexResult.Unlock()
+	sess.running += delta
+}
+
+// nextTransaction returns the transaction to execute next.
+// It returns nil if all transactions are dispatched.
+func (sess *Session) nextTransaction() *Transaction {
+	sess.mutexTransactions.Lock()
+	defer sess.mutexTransactions.Unlock()
+
+	if sess.dispatched < len(sess.transactions) {
+		tx := sess.transactions[sess.dispatched]
+		sess.dispatched++
+		return tx
+	}
+	if sess.sizer == nil || sess.sizerDone {
+		return nil
+	}
+	size := sess.sizer.getSize()
+	unsigned := sess.SplittableColumnUnsigned
+	rangeStart := toPosition(sess.nextRangeStart, unsigned)
+	last := toPosition(sess.SplittableColumnMaxValue, unsigned)
+	rangeEnd := last
+	if last-rangeStart >= uint64(size) {
+		rangeEnd = rangeStart + uint64(size) - 1
+	}
+	if rangeEnd == last {
+		sess.sizerDone = true
+	} else {
+		sess.nextRangeStart = positionValue(rangeEnd+1, unsigned)
+	}
+
+	id := sess.getNextID()
+	sess.nextID = id + 1
+	tx := &Transaction{
+		id:         id,
+		rangeStart: []interface{}{fromPosition(rangeStart, unsigned)},
+		rangeEnd:   []interface{}{fromPosition(rangeEnd, unsigned)},
+	}
+	sess.transactions = append(sess.transactions, tx)
+	sess.dispatched++
+
+	// estimate the number of transactions with current range.
+	plan := int64(len(sess.transactions))
+	if !sess.sizerDone {
+		plan += countRanges(rangeEnd+1, last, size)
+	}
+	sess.mutexResult.Lock()
+	sess.result.Plan = plan
+	sess.mutexResult.Unlock()
+
+	return tx
+}
+
+// getNextID returns the id of the next transaction created by sizer.
+// It is saved in the state, because completed transactions are not kept after resume.
+func (sess *Session) getNextID() int64 {
+	if sess.nextID > 0 {
+		return sess.nextID
+	}
+	id := int64(1)
+	for _, tx := range sess.transactions {
+		if tx.id >= id {
+			id = tx.id + 1
+		}
+	}
+	return id
+}
+
+// finishTransaction marks the transaction completed.
+// If the session has checkpoint file, the state is saved synchronously after each committed transaction,
+// not to execute it again on resume.
+func (sess *Session) finishTransaction(tx *Transaction, err error) error {
+	sess.mutexTransactions.Lock()
+	tx.completed = true
+	tx.failed = err != nil
+	tx.err = err
+	sess.mutexTransactions.Unlock()
+
+	if err != nil {
+		return nil
+	}
+	return sess.saveCheckpoint()
+}
+
+// saveCheckpoint saves the state of the session into the checkpoint file, if it's set.
+// Saves are serialized, not to overwrite the newer state with the older one.
+func (sess *Session) saveCheckpoint() error {
+	if sess.checkpointFile == "" {
+		return nil
+	}
+	sess.mutexCheckpoint.Lock()
+	defer sess.mutexCheckpoint.Unlock()
+	return sess.SaveState(sess.checkpointFile)
 }
 
 // GetSessionResult returns copy of session result data.
@@ -33,6 +238,9 @@ func (sess *Session) GetSessionResult() Result {
 }
 
 func (sess *Session) GetFailedTransactions() []*Transaction {
+	sess.mutexTransactions.Lock()
+	defer sess.mutexTransactions.Unlock()
+
 	transactions := []*Transaction{}
 	for _, tx := range sess.transactions {
 		if !tx.completed || !tx.failed {
@@ -44,11 +252,94 @@ func (sess *Session) GetFailedTransactions() []*Transaction {
 	return transactions
 }
 
+// getUnprocessedTransactions returns transactions which failed or not executed.
+func (sess *Session) getUnprocessedTransactions() []*Transaction {
+	sess.mutexTransactions.Lock()
+	defer sess.mutexTransactions.Unlock()
+
+	transactions := []*Transaction{}
+	for _, tx := range sess.transactions {
+		if tx.completed && !tx.failed {
+			continue
+		}
+		transactions = append(transactions, tx)
+	}
+	return transactions
+}
+
+// rangeValue returns the value of the split column kept in int64: int64, or uint64 for unsigned column.
+func (sess *Session) rangeValue(v int64) interface{} {
+	if sess.SplittableColumnUnsigned {
+		return uint64(v)
+	}
+	return v
+}
+
+// GetSplittableColumnRange returns MIN() and MAX() of the split column: int64, or uint64 for unsigned column.
+func (sess *Session) GetSplittableColumnRange() (min interface{}, max interface{}) {
+	return sess.rangeValue(sess.SplittableColumnMinValue), sess.rangeValue(sess.SplittableColumnMaxValue)
+}
+
+// GetUnprocessedRanges returns range conditions which are not committed yet.
+func (sess *Session) GetUnprocessedRanges() []string {
+	ranges := []string{}
+	for _, tx := range sess.getUnprocessedTransactions() {
+		ranges = append(ranges, sess.getRangeDescription(tx))
+	}
+
+	sess.mutexTransactions.Lock()
+	defer sess.mutexTransactions.Unlock()
+	if sess.sizer != nil && !sess.sizerDone {
+		// the rest of adaptive split range
+		ranges = append(ranges, sqlparser.String(sess.qualify(getValueRangeCondition(sess.SplittableColumn,
+			sess.rangeValue(sess.nextRangeStart), sess.rangeValue(sess.SplittableColumnMaxValue)))))
+	}
+	return ranges
+}
+
+// newRetrySession creates session data to execute transactions not committed.
+// If transactions are created with adaptive split range, the rest are continued.
+func (sess *Session) newRetrySession() *Session {
+	transactions := sess.getUnprocessedTransactions()
+	retrySess := &Session{
+		Query:                    sess.Query,
+		DBName:                   sess.DBName,
+		TableName:                sess.TableName,
+		SplittableColumn:         sess.SplittableColumn,
+		SplittableColumns:        sess.SplittableColumns,
+		SplittableColumnMinValue: sess.SplittableColumnMinValue,
+		SplittableColumnMaxValue: sess.SplittableColumnMaxValue,
+		SplittableColumnUnsigned: sess.SplittableColumnUnsigned,
+		SplittableColumnMinTime:  sess.SplittableColumnMinTime,
+		SplittableColumnMaxTime:  sess.SplittableColumnMaxTime,
+		SplitRange:               sess.SplitRange,
+		SplitInterval:            sess.SplitInterval,
+		SplitMode:                sess.SplitMode,
+		SplitTable:               sess.SplitTable,
+		stmt:                     sess.stmt,
+		qualifier:                sess.qualifier,
+		transactions:             transactions,
+		result:                   NewResult(int64(len(transactions))),
+	}
+
+	sess.mutexTransactions.Lock()
+	defer sess.mutexTransactions.Unlock()
+	if sess.sizer != nil && !sess.sizerDone {
+		retrySess.sizer = sess.sizer
+		retrySess.nextRangeStart = sess.nextRangeStart
+		retrySess.nextID = sess.getNextID()
+		retrySess.result.Plan += countRanges(toPosition(sess.nextRangeStart, sess.SplittableColumnUnsigned),
+			toPosition(sess.SplittableColumnMaxValue, sess.SplittableColumnUnsigned), sess.sizer.getSize())
+	}
+	return retrySess
+}
+
 // updateResult updates sessionResult.
-func (sess *Session) updateResult(err error, rowsAffected int64) error {
+func (sess *Session) updateResult(err error, rowsAffected int64, retried int64) error {
 	sess.mutexResult.Lock()
 	defer sess.mutexResult.Unlock()
 
+	sess.result.Retried += retried
 	if err != nil {
 		sess.result.Executed++
 		sess.result.Failed++
@@ -1,12 +1,15 @@
 package splmysql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/xwb1989/sqlparser"
 
 	// MySQL Driver
 	_ "github.com/go-sql-driver/mysql"
@@ -24,7 +27,8 @@ type Runner struct {
 	// DBName is the DB Name connected to
 	DBName string
 
-	// SplitRange is the max size of range used in splitted update
+	// SplitRange is the max size of range used in splitted update.
+	// In keyset mode, it is the max number of rows in splitted update.
 	SplitRange int64
 
 	// LogLevel is loglevel of logger
@@ -33,11 +37,79 @@ type Runner struct {
 	// UseDryRun is flag to enable dryrun mode
 	UseDryRun bool
 
+	// SplitColumn is the column to split by, instead of auto-detection.
+	// It must be an integer column, and the first column of any index.
+	SplitColumn string
+
+	// SplitTable is the alias or name of the table to split by in multi-table UPDATE or INSERT ... SELECT,
+	// like 'o' of 'UPDATE orders o JOIN users u ON ... SET o.x = u.y'.
+	// If it's empty, the table of the first column in SET clause, or the first table is used.
+	SplitTable string
+
+	// RangeMin and RangeMax are the range of SplitColumn to update, instead of its MIN() and MAX().
+	// They are decimal strings parsed with the signedness of the column, to give values of BIGINT UNSIGNED
+	// above 9223372036854775807. Empty means not given.
+	// If both of them are given, it skips 'SELECT MIN(), MAX()' of the column.
+	RangeMin string
+	RangeMax string
+
+	// SplitInterval is the interval of each splitted update on temporal column,
+	// like DATETIME, DATE or TIMESTAMP. If it's greater than 0 and SplitColumn is not given,
+	// it splits by an indexed temporal column. Default is DefaultSplitInterval.
+	SplitInterval time.Duration
+
 	// UseShuffle is flag to enable shuffle update mode.
 	UseShuffle bool
 
+	// UseDescending is flag to execute splitted updates from the max value of the split column.
+	// It's disabled with UseShuffle or TargetChunkTime.
+	UseDescending bool
+
+	// AllowSplitColumnUpdate is flag to allow queries which assign the split column in SET clause,
+	// like 'SET id = id + 1000000'. It requires UseDescending and parallel 1, which is safe for increasing values,
+	// because rows are moved only into the ranges already executed.
+	AllowSplitColumnUpdate bool
+
+	// UseRowCountSplit is flag to split by number of rows walking the index (keyset mode),
+	// instead of fixed width range of column values. It is useful for sparse key spaces.
+	UseRowCountSplit bool
+
+	// TargetChunkTime is the target execution time of each splitted update.
+	// If it's greater than 0, the range of the next transaction grows or shrinks
+	// from the measured duration of recent transactions, starting from SplitRange.
+	TargetChunkTime time.Duration
+
+	// CheckpointFile is the path of the file to save the session state while running.
+	// The file is used to resume interrupted runs by ResumeSession().
+	CheckpointFile string
+
+	// DrainTimeout is the time to wait for running transactions after the context of
+	// RunParallelContext() is done. They are cancelled after it.
+	// If it's 0, it waits for running transactions to finish.
+	DrainTimeout time.Duration
+
+	// Throttlers pause dispatching new transactions while the servers are busy.
+	Throttlers []Throttler
+
+	// ThrottleInterval is the interval to check Throttlers. Default is DefaultThrottleInterval.
+	ThrottleInterval time.Duration
+
+	// RetryPolicy is the policy to retry transactions failed with retryable errors.
+	RetryPolicy RetryPolicy
+
+	// TransactionHandlers are called when each transaction finished, like NewChunkLogHandler().
+	// They are called from multiple goroutines at once.
+	TransactionHandlers []TransactionHandler
+
+	// UseGalera is flag to lower SplitRange within 'wsrep_max_ws_rows' and 'wsrep_max_ws_size'
+	// of Galera Cluster. Use it with GaleraThrottler to pace dispatching under flow control.
+	UseGalera bool
+
 	// Sessions is splmysql sessions handled by this Runner
 	Sessions []*Session
+
+	// mutexSessions protects Sessions appended while other goroutines read it.
+	mutexSessions *sync.RWMutex
 }
 
 // DefaultSplitRange is lower than 131072
@@ -47,7 +119,9 @@ const DefaultSplitRange = int64(100000)
 func newRunner(dbName string) (sr Runner) {
 	sr = Runner{}
 	sr.DBName = dbName
+	sr.mutexSessions = &sync.RWMutex{}
 	sr.SetSplitRange(DefaultSplitRange)
+	sr.RetryPolicy = DefaultRetryPolicy()
 	sr.LogLevel = LogDefaultLevel
 
 	sr.initLogger()
@@ -105,78 +179,142 @@ func (sr *Runner) SetSplitRange(num int64) (oldValue int64) {
 
 // Connected checks the DB connection whether active or not.
 func (sr *Runner) Connected() bool {
+	return sr.ConnectedContext(context.Background())
+}
+
+// ConnectedContext checks the DB connection whether active or not, with context.
+func (sr *Runner) ConnectedContext(ctx context.Context) bool {
 	if sr.db != nil {
-		if err := sr.db.Ping(); err == nil {
+		if err := sr.db.PingContext(ctx); err == nil {
 			return true
 		}
 	}
 	return false
 }
 
+// GetSessions returns the sessions handled by this Runner.
+// It's safe to call while running.
+func (sr *Runner) GetSessions() []*Session {
+	sr.mutexSessions.RLock()
+	defer sr.mutexSessions.RUnlock()
+	return append([]*Session{}, sr.Sessions...)
+}
+
+func (sr *Runner) appendSession(sess *Session) {
+	sr.mutexSessions.Lock()
+	defer sr.mutexSessions.Unlock()
+	sr.Sessions = append(sr.Sessions, sess)
+}
+
 // Close disconnects the DB connection.
 func (sr *Runner) Close() {
 	sr.db.Close()
 }
 
-func (sr *Runner) getColumnDataForSplit(table string) (columnName string, minValue int64, maxValue int64, err error) {
-	maxValue = -1
-
+func (sr *Runner) showCreateTable(ctx context.Context, table string) (info string, err error) {
 	query := fmt.Sprintf(`SHOW CREATE TABLE %s`, table)
 	sr.tracef("Exec SQL: %s", query)
 
 	var returnedTableName string
-	var info string
-	if err := sr.db.QueryRow(query).Scan(&returnedTableName, &info); err != nil {
-		return "", -1, -1, err
+	if err := sr.db.QueryRowContext(ctx, query).Scan(&returnedTableName, &info); err != nil {
+		return "", err
 	}
+	return info, nil
+}
 
-	if columnName = findColumnNameForSplit(info); columnName == "" {
+// getColumnDataForSplit returns the column to split by and its range.
+// For unsigned column, minValue and maxValue keep the bits of uint64 values.
+func (sr *Runner) getColumnDataForSplit(ctx context.Context, table string) (columnName string, minValue int64, maxValue int64, unsigned bool, err error) {
+	info, err := sr.showCreateTable(ctx, table)
+	if err != nil {
+		return "", -1, -1, false, err
+	}
+
+	if sr.SplitColumn != "" {
+		if columnName, err = checkSplitColumn(info, sr.SplitColumn); err != nil {
+			return "", -1, -1, false, NewInvalidSplitColumnError(sr.SplitColumn, err.Error())
+		}
+		if _, notNull, _ := parseColumnInfo(info, columnName); !notNull {
+			sr.warnf("[%s.%s] The column '%s' is nullable. Rows with NULL are not updated.",
+				sr.DBName, table, columnName)
+		}
+	} else if columnName = findColumnNameForSplit(info); columnName == "" {
 		err = NewNoUsableColumnError(fmt.Sprintf("%s.%s", sr.DBName, table))
-		return "", -1, -1, err
+		return "", -1, -1, false, err
 	}
+	unsigned = isUnsignedColumn(info, columnName)
 
-	// search Max Value
-	var min, max sql.NullInt64
-	query = fmt.Sprintf(`SELECT MIN(%s), MAX(%s) FROM %s`, columnName, columnName, table)
-	sr.tracef("Exec SQL: %s", query)
-	if err := sr.db.QueryRow(query).Scan(&min, &max); err != nil {
-		return "", -1, -1, err
+	rangeMin, err := parseRangeOption(sr.RangeMin, unsigned)
+	if err != nil {
+		return "", -1, -1, false, NewInvalidSplitColumnError(columnName, "range min "+err.Error())
+	}
+	rangeMax, err := parseRangeOption(sr.RangeMax, unsigned)
+	if err != nil {
+		return "", -1, -1, false, NewInvalidSplitColumnError(columnName, "range max "+err.Error())
 	}
 
-	if !min.Valid || !max.Valid {
-		err = NewNoUsableColumnError(fmt.Sprintf("%s.%s", sr.DBName, table))
-		return "", -1, -1, err
+	if rangeMin != nil && rangeMax != nil {
+		minValue, maxValue = *rangeMin, *rangeMax
+	} else {
+		// search Max Value
+		// values are scanned as string, because BIGINT UNSIGNED may overflow int64.
+		var min, max sql.NullString
+		query := fmt.Sprintf(`SELECT MIN(%s), MAX(%s) FROM %s`, columnName, columnName, table)
+		sr.tracef("Exec SQL: %s", query)
+		if err := sr.db.QueryRowContext(ctx, query).Scan(&min, &max); err != nil {
+			return "", -1, -1, false, err
+		}
+		if !min.Valid || !max.Valid {
+			err = NewNoUsableColumnError(fmt.Sprintf("%s.%s", sr.DBName, table))
+			return "", -1, -1, false, err
+		}
+		if minValue, err = parseRangeValue(min.String, unsigned); err != nil {
+			return "", -1, -1, false, err
+		}
+		if maxValue, err = parseRangeValue(max.String, unsigned); err != nil {
+			return "", -1, -1, false, err
+		}
+
+		if rangeMin != nil {
+			minValue = *rangeMin
+		}
+		if rangeMax != nil {
+			maxValue = *rangeMax
+		}
 	}
-	minValue = min.Int64
-	maxValue = max.Int64
-	return
+
+	if toPosition(minValue, unsigned) > toPosition(maxValue, unsigned) {
+		err = NewInvalidSplitColumnError(columnName, fmt.Sprintf("min %s is greater than max %s",
+			formatValue(minValue, unsigned), formatValue(maxValue, unsigned)))
+		return "", -1, -1, false, err
+	}
+	return columnName, minValue, maxValue, unsigned, nil
 }
 
-func (sr *Runner) doUpdate(sql string) (rowsAffected int64, lastInsertID int64, err error) {
-	sr.tracef("DEBUG: exec %s", sql)
+func (sr *Runner) doUpdate(sql string, args ...interface{}) (rowsAffected int64, lastInsertID int64, err error) {
+	return sr.doUpdateContext(context.Background(), sql, args...)
+}
+
+// doUpdateContext executes the query in a transaction.
+// If ctx is done while executing, the transaction is rolled back.
+func (sr *Runner) doUpdateContext(ctx context.Context, query string, args ...interface{}) (rowsAffected int64, lastInsertID int64, err error) {
+	sr.tracef("DEBUG: exec %s %v", query, args)
 	if !sr.UseDryRun {
-		tx, err := sr.db.Begin()
-		if err != nil {
+		var tx *sql.Tx
+		if tx, err = sr.db.BeginTx(ctx, nil); err != nil {
 			return 0, 0, err
 		}
-		defer func() {
-			if err != nil {
-				tx.Rollback()
-				return
-			}
-			err = tx.Commit()
-		}()
 
-		result, err := tx.Exec(sql)
-		if err != nil {
+		var result sql.Result
+		if result, err = tx.ExecContext(ctx, query, args...); err != nil {
+			tx.Rollback()
 			return 0, 0, err
 		}
 		rowsAffected, _ = result.RowsAffected()
 		lastInsertID, _ = result.LastInsertId()
 
-		err = tx.Commit()
-		if err != nil {
-			return 0, 0, err
+		if err = tx.Commit(); err != nil {
+			return 0, 0, commitError(err)
 		}
 	}
 	return rowsAffected, lastInsertID, nil
@@ -184,60 +322,198 @@ func (sr *Runner) doUpdate(sql string) (rowsAffected int64, lastInsertID int64,
 
 // NewSession creates session data from query.
 func (sr *Runner) NewSession(query string) (session *Session, err error) {
+	return sr.NewSessionContext(context.Background(), query)
+}
+
+// NewSessionContext creates session data from query, with context.
+// If ctx is done while inspecting the table, it returns CanceledError.
+func (sr *Runner) NewSessionContext(ctx context.Context, query string) (session *Session, err error) {
+	session, err = sr.newSession(ctx, query)
+	if err != nil && ctx.Err() != nil {
+		// the errors of splmysql itself like invalid query are not caused by canceling.
+		if _, ok := err.(interface {
+			Code() int
+		}); !ok {
+			return nil, NewCanceledError(ctx.Err(), Result{})
+		}
+	}
+	return session, err
+}
+
+// invalidQueryMessage is the message of InvalidUpdateQueryError for the query which cannot be split.
+const invalidQueryMessage = "query must starts with 'UPDATE tablename SET ...', 'DELETE FROM tablename ...', " +
+	"'INSERT INTO tablename ... SELECT ...' or 'REPLACE INTO tablename ... SELECT ...'"
+
+func (sr *Runner) newSession(ctx context.Context, query string) (session *Session, err error) {
 	execQuery := strings.Trim(query, " ;")
-	if !isUpdateQuery(execQuery) {
-		return session, NewInvalidUpdateQueryError("query must starts with 'UPDATE tablename SET ...'")
+	if !isUpdateQuery(execQuery) && !isDeleteQuery(execQuery) && !isInsertQuery(execQuery) {
+		if reason := getUnsupportedSyntax(execQuery); reason != "" {
+			return session, NewInvalidUpdateQueryError("unsupported syntax, " + reason)
+		}
+		return session, NewInvalidUpdateQueryError(invalidQueryMessage)
 	}
 	if isLimitedQuery(execQuery) {
 		return session, NewInvalidUpdateQueryError("execute query has limit, its invalid")
 	}
 
-	tableName := getUpdateTableName(execQuery)
+	stmt, err := parseQuery(execQuery)
+	if err != nil {
+		return session, NewInvalidUpdateQueryError(err.Error())
+	}
+
+	var tableName string
+	var ref tableRef
+	multi := false
+	if isDeleteQuery(execQuery) {
+		if sr.SplitTable != "" {
+			sr.warnf("[%s] The split table is ignored with DELETE query.", sr.DBName)
+		}
+		tableName = getDeleteTableName(execQuery)
+	} else {
+		// UPDATE may have multiple tables, like 'UPDATE orders o JOIN users u ON ... SET ...',
+		// and 'INSERT ... SELECT' is split by the table of SELECT.
+		if ref, multi, err = getDrivingTable(stmt, sr.SplitTable); err != nil {
+			return session, NewInvalidUpdateQueryError(err.Error())
+		}
+		tableName = sqlparser.String(ref.name)
+	}
 	if tableName == "" {
-		return session, NewInvalidUpdateQueryError("query must starts with 'UPDATE tablename SET ...'")
+		return session, NewInvalidUpdateQueryError(invalidQueryMessage)
+	}
+
+	if multi {
+		sr.debugf("[%s.%s] This session splits multi-table query by the table '%s'.",
+			sr.DBName, tableName, sqlparser.String(ref.qualifier()))
 	}
 
-	columnName, min, max, err := sr.getColumnDataForSplit(tableName)
+	session, err = sr.newTableSession(ctx, execQuery, stmt, tableName)
 	if err != nil {
 		return session, err
-	} else if columnName == "" || min < 0 || max < 0 {
+	}
+	if err := checkInsertAggregation(stmt, ref, session.SplittableColumns); err != nil {
+		return nil, NewInvalidUpdateQueryError(err.Error())
+	}
+	if multi {
+		session.SplitTable = sqlparser.String(ref.qualifier())
+		session.qualifier = ref.qualifier()
+	}
+	return session, nil
+}
+
+// newTableSession creates session data which splits the statement by the column of the table.
+func (sr *Runner) newTableSession(ctx context.Context, execQuery string, stmt sqlparser.Statement, tableName string) (session *Session, err error) {
+	// splitRange is lowered within the write set limits in Galera mode, without changing SplitRange of the Runner.
+	splitRange, maxSplitRange := sr.SplitRange, int64(0)
+	if sr.UseGalera {
+		if maxSplitRange, err = sr.getGaleraMaxSplitRange(ctx, tableName); err != nil {
+			return session, err
+		}
+	}
+
+	if columnName, columnType, err := sr.getTemporalColumnForSplit(ctx, tableName); err != nil {
+		return session, err
+	} else if columnName != "" {
+		return sr.newTimeSession(ctx, execQuery, stmt, tableName, columnName, columnType, maxSplitRange)
+	}
+
+	if maxSplitRange > 0 && splitRange > maxSplitRange {
+		sr.warnf("[%s.%s] Split range is lowered from %d to %d for Galera Cluster.",
+			sr.DBName, tableName, splitRange, maxSplitRange)
+		splitRange = maxSplitRange
+	}
+
+	columnName, min, max, unsigned, err := sr.getColumnDataForSplit(ctx, tableName)
+	if _, ok := err.(*NoUsableColumnError); ok && sr.SplitColumn == "" {
+		// try to split with composite or string Primary Key
+		columnNames, kinds, kerr := sr.getKeyColumnsForSplit(ctx, tableName)
+		if kerr == nil {
+			return sr.newKeysetSession(ctx, execQuery, stmt, tableName, columnNames, kinds, splitRange)
+		}
+		// try to split with temporal column
+		info, terr := sr.showCreateTable(ctx, tableName)
+		if terr != nil {
+			return session, err
+		}
+		if columnName, columnType := findTemporalColumnForSplit(info); columnName != "" {
+			return sr.newTimeSession(ctx, execQuery, stmt, tableName, columnName, columnType, maxSplitRange)
+		}
+		return session, err
+	} else if err != nil {
+		return session, err
+	} else if columnName == "" {
 		return session, NewNoUsableColumnError(fmt.Sprintf("%s.%s", sr.DBName, tableName))
 	}
 
-	sr.debugf("[%s.%s] The column name to split is '%s': min '%d' - max '%d'",
-		sr.DBName, tableName, columnName, min, max)
+	sr.debugf("[%s.%s] The column name to split is '%s': min '%s' - max '%s'",
+		sr.DBName, tableName, columnName, formatValue(min, unsigned), formatValue(max, unsigned))
 
-	// create transactions.
-	transactions := []*Transaction{}
-	for i := int64(0); i < max/sr.SplitRange+1; i++ {
-		tx := Transaction{
-			id:         i + 1,
-			rangeStart: i * sr.SplitRange,
-			rangeEnd:   (i+1)*sr.SplitRange - 1,
-		}
-		if tx.rangeEnd < min || tx.rangeStart > max {
-			//   current values:    |------|
-			// this transaction: |-|
-			//               or             |-|
-			// - this transaction is out of range. skip it.
-			continue
-		} else if tx.rangeStart < min {
-			//   current values:    |------|
-			// this transaction:  |---|
-			tx.rangeStart = min
+	if sr.UseRowCountSplit {
+		if sr.RangeMin != "" || sr.RangeMax != "" {
+			sr.warnf("[%s.%s] The range of the column is ignored with split by rows.", sr.DBName, tableName)
+		}
+		kind := keyInt
+		if unsigned {
+			kind = keyUint
 		}
-		if tx.rangeEnd > max {
-			//   current values:    |------|
-			// this transaction:         |---|
-			tx.rangeEnd = max
+		session, err = sr.newKeysetSession(ctx, execQuery, stmt, tableName, []string{columnName}, []keyKind{kind}, splitRange)
+		if err != nil {
+			return session, err
 		}
+		session.SplittableColumnMinValue = min
+		session.SplittableColumnMaxValue = max
+		session.SplittableColumnUnsigned = unsigned
+		return session, nil
+	}
 
-		transactions = append(transactions, &tx)
+	if sr.TargetChunkTime > 0 {
+		if sr.UseShuffle {
+			sr.warnf("[%s.%s] Shuffle mode is disabled with target chunk time.", sr.DBName, tableName)
+		}
+		if sr.UseDescending {
+			sr.warnf("[%s.%s] Descending mode is disabled with target chunk time.", sr.DBName, tableName)
+		}
+		if err := sr.checkSplitColumnUpdate(stmt, []string{columnName}, false); err != nil {
+			return session, err
+		}
+		sr.debugf("[%s.%s] This session uses adaptive split range (target %s per query).",
+			sr.DBName, tableName, sr.TargetChunkTime)
+
+		session = &Session{
+			Query:                    execQuery,
+			DBName:                   sr.DBName,
+			TableName:                tableName,
+			SplittableColumn:         columnName,
+			SplittableColumns:        []string{columnName},
+			SplittableColumnMinValue: min,
+			SplittableColumnMaxValue: max,
+			SplittableColumnUnsigned: unsigned,
+			SplitRange:               splitRange,
+			SplitMode:                SplitByRange,
+			stmt:                     stmt,
+			transactions:             []*Transaction{},
+			result:                   NewResult(countRanges(toPosition(min, unsigned), toPosition(max, unsigned), splitRange)),
+			sizer:                    newChunkSizer(sr.TargetChunkTime, splitRange, maxSplitRange),
+			nextRangeStart:           min,
+		}
+		return session, nil
+	}
+
+	if err := sr.checkSplitColumnUpdate(stmt, []string{columnName}, sr.isDescending()); err != nil {
+		return session, err
 	}
 
+	// create transactions.
+	if n := countRanges(toPosition(min, unsigned), toPosition(max, unsigned), splitRange); n > MaxRangeTransactions {
+		return session, newTooManyRangesError(columnName, n)
+	}
+	transactions := newRangeTransactions(min, max, unsigned, splitRange)
+
 	if sr.UseShuffle {
 		sr.debugf("[%s.%s] This session enable shuffle mode.", sr.DBName, tableName)
 		shuffleTransactions(transactions)
+	} else if sr.UseDescending {
+		sr.debugf("[%s.%s] This session enable descending mode.", sr.DBName, tableName)
+		reverseTransactions(transactions)
 	}
 
 	// create split update session information
@@ -246,9 +522,13 @@ func (sr *Runner) NewSession(query string) (session *Session, err error) {
 		DBName:                   sr.DBName,
 		TableName:                tableName,
 		SplittableColumn:         columnName,
+		SplittableColumns:        []string{columnName},
 		SplittableColumnMinValue: min,
 		SplittableColumnMaxValue: max,
-		SplitRange:               sr.SplitRange,
+		SplittableColumnUnsigned: unsigned,
+		SplitRange:               splitRange,
+		SplitMode:                SplitByRange,
+		stmt:                     stmt,
 		transactions:             transactions,
 		result:                   NewResult(int64(len(transactions))),
 	}
@@ -259,10 +539,92 @@ func (sr *Runner) NewSession(query string) (session *Session, err error) {
 	return session, nil
 }
 
+// newKeysetSession creates session data which splits by key tuples, splitRange rows per query.
+func (sr *Runner) newKeysetSession(ctx context.Context, execQuery string, stmt sqlparser.Statement, tableName string, columnNames []string, kinds []keyKind, splitRange int64) (session *Session, err error) {
+	sr.debugf("[%s.%s] The columns to split are '%s' (keyset mode, %d rows per query)",
+		sr.DBName, tableName, strings.Join(columnNames, ", "), splitRange)
+
+	if err := sr.checkSplitColumnUpdate(stmt, columnNames, sr.isDescending()); err != nil {
+		return session, err
+	}
+
+	boundaries, err := sr.getKeysetBoundaries(ctx, tableName, columnNames, kinds, splitRange)
+	if err != nil {
+		return session, err
+	}
+	transactions := newKeysetTransactions(boundaries)
+
+	if sr.UseShuffle {
+		sr.debugf("[%s.%s] This session enable shuffle mode.", sr.DBName, tableName)
+		shuffleTransactions(transactions)
+	} else if sr.UseDescending {
+		sr.debugf("[%s.%s] This session enable descending mode.", sr.DBName, tableName)
+		reverseTransactions(transactions)
+	}
+
+	session = &Session{
+		Query:             execQuery,
+		DBName:            sr.DBName,
+		TableName:         tableName,
+		SplittableColumn:  strings.Join(columnNames, ","),
+		SplittableColumns: columnNames,
+		SplitRange:        splitRange,
+		SplitMode:         SplitByKeyset,
+		stmt:              stmt,
+		transactions:      transactions,
+		result:            NewResult(int64(len(transactions))),
+	}
+
+	sr.debugf("[%s.%s] This session executes %d queries.",
+		sr.DBName, tableName, len(session.transactions))
+
+	return session, nil
+}
+
+// isDescending returns true if splitted updates are executed from the max value.
+func (sr *Runner) isDescending() bool {
+	return sr.UseDescending && !sr.UseShuffle
+}
+
+// checkSplitColumnUpdate returns SplitColumnUpdateError if the statement assigns the split columns,
+// unless it's allowed and executed in descending order.
+func (sr *Runner) checkSplitColumnUpdate(stmt sqlparser.Statement, columnNames []string, descending bool) error {
+	var qualifier sqlparser.TableName
+	if ref, multi, err := getDrivingTable(stmt, sr.SplitTable); err == nil && multi {
+		qualifier = ref.qualifier()
+	}
+	column := getAssignedColumn(stmt, qualifier, columnNames)
+	if column == "" {
+		return nil
+	}
+	if !sr.AllowSplitColumnUpdate {
+		return NewSplitColumnUpdateError(column, "rows may be moved into later ranges and updated twice")
+	}
+	if !descending {
+		return NewSplitColumnUpdateError(column, "it's allowed only in descending order, without shuffle or target chunk time")
+	}
+	sr.warnf("[%s] The query updates the split column '%s'. It's safe only if the values increase.", sr.DBName, column)
+	return nil
+}
+
 // RunParallel executes session parallel
 func (sr *Runner) RunParallel(sess *Session, parallel int) (retrySessionData *Session, err error) {
+	return sr.RunParallelContext(context.Background(), sess, parallel)
+}
+
+// RunParallelContext executes session parallel.
+// Each transaction failed with retryable errors is retried with RetryPolicy.
+// If ctx is done, it stops executing new transactions and waits for running transactions
+// (for DrainTimeout at most). Then it returns the session data of unprocessed transactions
+// with CanceledError, which has the partial result.
+// The query which assigns the split column is executed only with parallel 1.
+func (sr *Runner) RunParallelContext(ctx context.Context, sess *Session, parallel int) (retrySessionData *Session, err error) {
+	if column := getAssignedColumn(sess.stmt, sess.qualifier, sess.SplittableColumns); column != "" && parallel > 1 {
+		return nil, NewSplitColumnUpdateError(column, "it's allowed only with parallel 1")
+	}
+
 	// append Session
-	sr.Sessions = append(sr.Sessions, sess)
+	sr.appendSession(sess)
 
 	semaphore := make(chan struct{}, parallel)
 	sr.db.SetMaxIdleConns(parallel)
@@ -271,26 +633,83 @@ func (sr *Runner) RunParallel(sess *Session, parallel int) (retrySessionData *Se
 
 	sr.infof("[%s.%s] Session start (planned %d queries)", sess.DBName, sess.TableName, sess.result.Plan)
 
+	// save checkpoint after each committed transaction, and at the end.
+	if sr.CheckpointFile != "" && !sr.UseDryRun {
+		sess.checkpointFile = sr.CheckpointFile
+	}
+	saveCheckpoint := func(err error) {
+		if err != nil {
+			sr.errorf("[%s.%s] Failed to save checkpoint: %s", sess.DBName, sess.TableName, err.Error())
+		}
+	}
+
+	// running transactions are cancelled only after DrainTimeout.
+	execCtx, cancelExec := context.WithCancel(context.Background())
+	defer cancelExec()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-execCtx.Done():
+			return
+		}
+		if sr.DrainTimeout <= 0 {
+			return
+		}
+		timer := time.NewTimer(sr.DrainTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			sr.warnf("[%s.%s] Cancel running queries after %s.", sess.DBName, sess.TableName, sr.DrainTimeout)
+			cancelExec()
+		case <-execCtx.Done():
+		}
+	}()
+
+	throttle := &throttleState{sr: sr, sess: sess}
+	var abortErr error
+
 	var wg sync.WaitGroup
-	for _, transaction := range sess.transactions {
+	for ctx.Err() == nil {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+		if abortErr = throttle.wait(ctx); abortErr != nil {
+			<-semaphore
+			break
+		}
+		if ctx.Err() != nil {
+			<-semaphore
+			break
+		}
+		transaction := sess.nextTransaction()
+		if transaction == nil {
+			<-semaphore
+			break
+		}
 		wg.Add(1)
-		semaphore <- struct{}{}
+		sess.addRunning(1)
 		go func(tx *Transaction) error {
 			defer wg.Done()
+			defer sess.addRunning(-1)
 
-			start := tx.rangeStart
-			end := tx.rangeEnd
-			updateSQL := getSplittedUpdateSQL(sess.Query, sess.SplittableColumn, start, end)
-			sr.tracef("- (%d) update (range: %s = %d - %d) start",
-				tx.id, sess.SplittableColumn, start, end)
+			updateSQL, args := sess.getSplittedSQL(tx)
+			sr.tracef("- (%d) update (range: %s) start", tx.id, sess.getRangeDescription(tx))
 
-			rowsAffected, _, err := sr.doUpdate(updateSQL)
-			tx.completed = true
+			start := time.Now()
+			rowsAffected, attempts, err := sr.doUpdateWithRetry(ctx, execCtx, updateSQL, args...)
+			elapsed := time.Since(start)
+			if err == nil && sess.sizer != nil && attempts == 1 && !sr.UseDryRun {
+				// the elapsed time with retries or dryrun is not the execution time.
+				sess.sizer.update(rangeSize(tx.rangeStart[0], tx.rangeEnd[0]), elapsed)
+			}
+			saveCheckpoint(sess.finishTransaction(tx, err))
 			if err != nil {
 				sr.warnf("- (%d) ERROR: %s", tx.id, err.Error())
-				tx.failed = true
 			}
-			sess.updateResult(err, rowsAffected)
+			sess.updateResult(err, rowsAffected, int64(attempts-1))
+			sr.handleTransaction(sess.newTransactionReport(tx, rowsAffected, elapsed, attempts, err))
 			sr.infof("[%d] - Affected %d rows, total %d updated.", tx.id, rowsAffected, sess.result.RowsAffected)
 
 			<-semaphore
@@ -299,20 +718,20 @@ func (sr *Runner) RunParallel(sess *Session, parallel int) (retrySessionData *Se
 	}
 	wg.Wait()
 	close(semaphore)
+	saveCheckpoint(sess.saveCheckpoint())
 
 	r := sess.GetSessionResult()
+	if ctx.Err() != nil {
+		sr.warnf("[%s.%s] Session interrupted: %d queries executed, %d rows updated.",
+			sess.DBName, sess.TableName, r.Executed, r.RowsAffected)
+		return sess.newRetrySession(), NewCanceledError(ctx.Err(), r)
+	}
+	if abortErr != nil {
+		sr.errorf("[%s.%s] Session aborted: %s", sess.DBName, sess.TableName, abortErr.Error())
+		return sess.newRetrySession(), abortErr
+	}
 	if r.Failed > 0 {
-		retrySessionData = &Session{
-			Query:                    sess.Query,
-			DBName:                   sess.DBName,
-			TableName:                sess.TableName,
-			SplittableColumn:         sess.SplittableColumn,
-			SplittableColumnMinValue: sess.SplittableColumnMinValue,
-			SplittableColumnMaxValue: sess.SplittableColumnMaxValue,
-			SplitRange:               sess.SplitRange,
-			transactions:             sess.GetFailedTransactions(),
-			result:                   NewResult(int64(len(sess.GetFailedTransactions()))),
-		}
+		retrySessionData = sess.newRetrySession()
 		err = fmt.Errorf("[%s.%s] %d transactions failed\n", sess.DBName, sess.TableName, r.Failed)
 		return
 	}
@@ -323,11 +742,17 @@ func (sr *Runner) RunParallel(sess *Session, parallel int) (retrySessionData *Se
 	return
 }
 
-// SimpleUpdate executes UPDATE query simply, no modifies.
+// SimpleUpdate executes UPDATE, DELETE or INSERT ... SELECT query simply, no modifies.
 func (sr *Runner) SimpleUpdate(query string) (result Result, err error) {
+	return sr.SimpleUpdateContext(context.Background(), query)
+}
+
+// SimpleUpdateContext executes UPDATE, DELETE or INSERT ... SELECT query simply, with context.
+// If ctx is done while executing, the query is rolled back and it returns CanceledError.
+func (sr *Runner) SimpleUpdateContext(ctx context.Context, query string) (result Result, err error) {
 	execQuery := strings.Trim(query, " ;")
-	if !isUpdateQuery(execQuery) {
-		return result, NewInvalidUpdateQueryError("execute query must start with 'UPDATE tablename SET ...'")
+	if !isUpdateQuery(execQuery) && !isDeleteQuery(execQuery) && !isInsertQuery(execQuery) {
+		return result, NewInvalidUpdateQueryError("execute " + invalidQueryMessage)
 	}
 	// create dummy session
 	session := Session{
@@ -342,24 +767,21 @@ func (sr *Runner) SimpleUpdate(query string) (result Result, err error) {
 		result:                   NewResult(1),
 	}
 	// append Session
-	sr.Sessions = append(sr.Sessions, &session)
+	sr.appendSession(&session)
 
-	rowsAffected, _, err := sr.doUpdate(execQuery)
-	session.result.Executed = 1
+	rowsAffected, attempts, err := sr.doUpdateWithRetry(ctx, ctx, execQuery)
+	err = session.updateResult(err, rowsAffected, int64(attempts-1))
+	result = session.GetSessionResult()
 	if err != nil {
-		session.result.RowsAffected = 0
-		session.result.Succeeded = 0
-		session.result.Failed = 1
-
+		if ctx.Err() != nil {
+			return result, NewCanceledError(ctx.Err(), result)
+		}
 		return result, err
 	}
-	session.result.RowsAffected = rowsAffected
-	session.result.Succeeded = 1
-	session.result.Failed = 0
 
-	sr.infof("[%s] Total %d rows updated.", sr.DBName, rowsAffected)
+	sr.infof("[%s] Total %d rows updated.", sr.DBName, result.RowsAffected)
 	sr.infof("[%s] Executed %d queries: %d succeeded, %d failed.",
 		sr.DBName, result.Executed, result.Succeeded, result.Failed)
 
-	return
+	return result, nil
 }
@@ -0,0 +1,254 @@
+package splmysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubResult is the result of a query in the stub DB. columns can be nil if they are scanned by position.
+// If args is not nil, the query fails with other arguments.
+// rowsAffected is returned by the query executed in a transaction.
+type stubResult struct {
+	columns      []string
+	rows         [][]driver.Value
+	args         []driver.Value
+	rowsAffected int64
+}
+
+// stubConn is the connection of database/sql driver which returns the stub result of the query which has the prefix.
+type stubConn map[string]stubResult
+
+var stubDBs = struct {
+	sync.Mutex
+	conns map[string]stubConn
+}{conns: map[string]stubConn{}}
+
+type stubDriver struct{}
+
+func init() {
+	sql.Register("splmysql_stub", stubDriver{})
+}
+
+// openStubDB opens the stub DB which returns results for the queries.
+func openStubDB(t *testing.T, results map[string]stubResult) *sql.DB {
+	stubDBs.Lock()
+	name := fmt.Sprintf("%s-%d", t.Name(), len(stubDBs.conns))
+	stubDBs.conns[name] = results
+	stubDBs.Unlock()
+	db, err := sql.Open("splmysql_stub", name)
+	assert.Nil(t, err)
+	return db
+}
+
+func (stubDriver) Open(name string) (driver.Conn, error) {
+	stubDBs.Lock()
+	defer stubDBs.Unlock()
+	return stubDBs.conns[name], nil
+}
+
+func (c stubConn) Prepare(query string) (driver.Stmt, error) {
+	for prefix, result := range c {
+		if strings.HasPrefix(query, prefix) {
+			return stubStmt(result), nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected query: %s", query)
+}
+func (c stubConn) Close() error              { return nil }
+func (c stubConn) Begin() (driver.Tx, error) { return stubTx{}, nil }
+
+type stubTx struct{}
+
+func (stubTx) Commit() error   { return nil }
+func (stubTx) Rollback() error { return nil }
+
+type stubStmt stubResult
+
+func (s stubStmt) Close() error  { return nil }
+func (s stubStmt) NumInput() int { return -1 }
+func (s stubStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.args != nil && !reflect.DeepEqual(s.args, args) {
+		return nil, fmt.Errorf("unexpected arguments: %v", args)
+	}
+	return driver.RowsAffected(s.rowsAffected), nil
+}
+func (s stubStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.args != nil && !reflect.DeepEqual(s.args, args) {
+		return nil, fmt.Errorf("unexpected arguments: %v", args)
+	}
+	return &stubRows{result: stubResult(s)}, nil
+}
+
+type stubRows struct {
+	result stubResult
+	i      int
+}
+
+func (r *stubRows) Columns() []string {
+	if r.result.columns == nil && len(r.result.rows) > 0 {
+		return make([]string, len(r.result.rows[0]))
+	}
+	return r.result.columns
+}
+func (r *stubRows) Close() error { return nil }
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.result.rows) {
+		return io.EOF
+	}
+	copy(dest, r.result.rows[r.i])
+	r.i++
+	return nil
+}
+
+func TestRunParallelContextCanceled(t *testing.T) {
+	// sql.Open does not connect to DB.
+	sr, err := NewByOptions("db", "127.0.0.1", 3306, "user", "pass", "")
+	assert.Nil(t, err)
+	defer sr.Close()
+
+	stmt, err := parseQuery("UPDATE foo SET yo = 'hey'")
+	assert.Nil(t, err)
+	sess := &Session{
+		Query:            "UPDATE foo SET yo = 'hey'",
+		DBName:           "db",
+		TableName:        "foo",
+		SplittableColumn: "id",
+		SplitMode:        SplitByRange,
+		stmt:             stmt,
+		transactions: []*Transaction{
+			{id: 1, rangeStart: []interface{}{int64(0)}, rangeEnd: []interface{}{int64(99)}},
+			{id: 2, rangeStart: []interface{}{int64(100)}, rangeEnd: []interface{}{int64(199)}},
+		},
+		result: NewResult(2),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	retrySess, err := sr.RunParallelContext(ctx, sess, 2)
+	canceled, ok := err.(*CanceledError)
+	assert.True(t, ok)
+	assert.Equal(t, context.Canceled, canceled.Unwrap())
+	assert.Equal(t, CanceledErrorCode, canceled.Code())
+	assert.Equal(t, int64(2), canceled.Result.Plan)
+	assert.Equal(t, int64(0), canceled.Result.Executed)
+	assert.Equal(t, int64(0), sess.GetSessionResult().Executed)
+	assert.Equal(t, int64(2), retrySess.GetSessionResult().Plan)
+	assert.Equal(t, []string{"id between 0 and 99", "id between 100 and 199"}, sess.GetUnprocessedRanges())
+}
+
+func TestNewSessionContextCanceled(t *testing.T) {
+	sr, err := NewByOptions("db", "127.0.0.1", 3306, "user", "pass", "")
+	assert.Nil(t, err)
+	defer sr.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sess, err := sr.NewSessionContext(ctx, "UPDATE foo SET yo = 'hey'")
+	assert.Nil(t, sess)
+	_, ok := err.(*CanceledError)
+	assert.True(t, ok)
+
+	// invalid query is not canceled error
+	_, err = sr.NewSessionContext(ctx, "SELECT * FROM foo")
+	_, ok = err.(*InvalidUpdateQueryError)
+	assert.True(t, ok)
+	_, err = sr.NewSessionContext(ctx, "INSERT INTO foo (id) VALUES (1)")
+	_, ok = err.(*InvalidUpdateQueryError)
+	assert.True(t, ok)
+
+	_, err = sr.SimpleUpdateContext(ctx, "UPDATE foo SET yo = 'hey'")
+	canceled, ok := err.(*CanceledError)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), canceled.Result.Executed)
+	assert.Equal(t, int64(1), canceled.Result.Failed)
+	assert.False(t, sr.ConnectedContext(ctx))
+}
+
+func TestSimpleUpdateContext(t *testing.T) {
+	db := openStubDB(t, map[string]stubResult{
+		"UPDATE foo SET yo = 'hey'": {rowsAffected: 42},
+	})
+	defer db.Close()
+	sr := newRunner("db")
+	sr.db = db
+
+	result, err := sr.SimpleUpdateContext(context.Background(), "UPDATE foo SET yo = 'hey';")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.Executed)
+	assert.Equal(t, int64(1), result.Succeeded)
+	assert.Equal(t, int64(0), result.Failed)
+	assert.Equal(t, int64(42), result.RowsAffected)
+
+	// the failed query is counted in the result, too.
+	result, err = sr.SimpleUpdateContext(context.Background(), "DELETE FROM foo")
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(1), result.Executed)
+	assert.Equal(t, int64(0), result.Succeeded)
+	assert.Equal(t, int64(1), result.Failed)
+}
+
+func TestGetUnprocessedRanges(t *testing.T) {
+	sess := &Session{
+		SplittableColumn:  "tenant_id,id",
+		SplittableColumns: []string{"tenant_id", "id"},
+		SplitMode:         SplitByKeyset,
+		transactions: newKeysetTransactions([][]interface{}{
+			{int64(1), int64(10)},
+			{int64(2), int64(20)},
+			{int64(3), int64(30)},
+		}),
+	}
+	sess.finishTransaction(sess.transactions[0], nil)
+	sess.finishTransaction(sess.transactions[1], assert.AnError)
+	assert.Equal(t, []string{
+		"(tenant_id, id) > (1, 10) and (tenant_id, id) <= (2, 20)",
+		"(tenant_id, id) > (2, 20) and (tenant_id, id) <= (3, 30)",
+	}, sess.GetUnprocessedRanges())
+
+	retrySess := sess.newRetrySession()
+	assert.Equal(t, int64(2), retrySess.GetSessionResult().Plan)
+	assert.Equal(t, SplitByKeyset, retrySess.SplitMode)
+}
+
+func TestCheckSplitColumnUpdate(t *testing.T) {
+	sr := newRunner("db")
+	stmt, err := parseQuery("UPDATE foo SET id = id + 1000000 WHERE yo = 'hey'")
+	assert.Nil(t, err)
+
+	err = sr.checkSplitColumnUpdate(stmt, []string{"id"}, true)
+	if assert.IsType(t, &SplitColumnUpdateError{}, err) {
+		assert.Equal(t, "id", err.(*SplitColumnUpdateError).Column)
+		assert.Equal(t, SplitColumnUpdateErrorCode, err.(*SplitColumnUpdateError).Code())
+	}
+
+	sr.AllowSplitColumnUpdate = true
+	assert.IsType(t, &SplitColumnUpdateError{}, sr.checkSplitColumnUpdate(stmt, []string{"id"}, false))
+	assert.Nil(t, sr.checkSplitColumnUpdate(stmt, []string{"id"}, true))
+
+	// other columns are not checked.
+	sr.AllowSplitColumnUpdate = false
+	assert.Nil(t, sr.checkSplitColumnUpdate(stmt, []string{"uid"}, false))
+
+	// parallel execution is refused.
+	sess := &Session{
+		DBName:            "db",
+		TableName:         "foo",
+		SplittableColumn:  "id",
+		SplittableColumns: []string{"id"},
+		stmt:              stmt,
+		result:            NewResult(0),
+	}
+	_, err = sr.RunParallelContext(context.Background(), sess, 2)
+	if assert.IsType(t, &SplitColumnUpdateError{}, err) {
+		assert.Equal(t, "id", err.(*SplitColumnUpdateError).Column)
+	}
+}
@@ -0,0 +1,254 @@
+package splmysql
+
+/*
+Temporal splitting splits by fixed width interval of DATETIME, DATE or TIMESTAMP column,
+for the tables which have no usable integer key, like log tables with indexed 'created_at'.
+Each range is half-open, 'column >= start AND column < end'.
+*/
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// DefaultSplitInterval is the default interval of each splitted update on temporal column.
+const DefaultSplitInterval = time.Hour
+
+// timeValueLayout is the layout of temporal values in SQL.
+const (
+	timeValueLayout      = "2006-01-02 15:04:05"
+	timeValueMicroLayout = "2006-01-02 15:04:05.000000"
+)
+
+// isTemporalType returns true if the column type is DATETIME, DATE or TIMESTAMP.
+func isTemporalType(typeName string) bool {
+	typeName = strings.ToLower(strings.Trim(typeName, " "))
+	for _, t := range []string{"datetime", "date", "timestamp"} {
+		if typeName == t || strings.HasPrefix(typeName, t+"(") {
+			return true
+		}
+	}
+	return false
+}
+
+// findTemporalColumnForSplit parses 'SHOW CREATE TABLE' info and get temporal column name for split.
+// The column must have 'NOT NULL' statement, and be the first column of any index.
+func findTemporalColumnForSplit(info string) (columnName string, columnType string) {
+	// `created_at` datetime NOT NULL,\n
+	reColumn := regexp.MustCompile(
+		`^\s*[` + "`" + `'"]([^` + "`" + `'"]+)[` + "`" + `'"]` + // `created_at`
+			`\s+([^\s,]+)(\s.*)?\snot\s+null[\s,].*$`) // datetime NOT NULL,
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.ToLower(line)
+		if !reColumn.MatchString(line) {
+			continue
+		}
+		columnName = reColumn.ReplaceAllString(line, "$1")
+		columnType = reColumn.ReplaceAllString(line, "$2")
+		if isTemporalType(columnType) && isIndexedColumn(info, columnName) {
+			return columnName, columnType
+		}
+	}
+	return "", ""
+}
+
+// parseTimeValue parses temporal value returned by MySQL.
+func parseTimeValue(s string) (time.Time, error) {
+	for _, layout := range []string{timeValueLayout + ".999999999", "2006-01-02", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid temporal value '%s'", s)
+}
+
+// formatTimeValue returns the temporal value in SQL, like '2018-01-02 03:04:05'.
+// The location of t is ignored, because MySQL compares the value in the session time zone.
+func formatTimeValue(t time.Time) string {
+	if t.Nanosecond() != 0 {
+		return t.Format(timeValueMicroLayout)
+	}
+	return t.Format(timeValueLayout)
+}
+
+// getTemporalColumnForSplit returns temporal column to split by, if SplitColumn is temporal type
+// or SplitInterval is given. It returns empty name if the session splits by integer column.
+func (sr *Runner) getTemporalColumnForSplit(ctx context.Context, table string) (columnName string, columnType string, err error) {
+	if sr.SplitColumn == "" && sr.SplitInterval <= 0 {
+		return "", "", nil
+	}
+	info, err := sr.showCreateTable(ctx, table)
+	if err != nil {
+		return "", "", err
+	}
+
+	if sr.SplitColumn == "" {
+		if columnName, columnType = findTemporalColumnForSplit(info); columnName == "" {
+			return "", "", NewNoUsableColumnError(fmt.Sprintf("%s.%s", sr.DBName, table))
+		}
+		return columnName, columnType, nil
+	}
+
+	columnType, notNull, found := parseColumnInfo(info, sr.SplitColumn)
+	if !found || !isTemporalType(columnType) {
+		// checked as integer column.
+		return "", "", nil
+	}
+	if !isIndexedColumn(info, sr.SplitColumn) {
+		return "", "", NewInvalidSplitColumnError(sr.SplitColumn, "column is not the first column of any index")
+	}
+	if !notNull {
+		sr.warnf("[%s.%s] The column '%s' is nullable. Rows with NULL are not updated.",
+			sr.DBName, table, sr.SplitColumn)
+	}
+	return strings.ToLower(sr.SplitColumn), columnType, nil
+}
+
+// getTimeRange returns MIN() and MAX() of the temporal column.
+func (sr *Runner) getTimeRange(ctx context.Context, table string, columnName string) (minValue time.Time, maxValue time.Time, err error) {
+	var min, max sql.NullString
+	query := fmt.Sprintf(`SELECT MIN(%s), MAX(%s) FROM %s`, columnName, columnName, table)
+	sr.tracef("Exec SQL: %s", query)
+	if err := sr.db.QueryRowContext(ctx, query).Scan(&min, &max); err != nil {
+		return minValue, maxValue, err
+	}
+	if !min.Valid || !max.Valid {
+		return minValue, maxValue, NewNoUsableColumnError(fmt.Sprintf("%s.%s", sr.DBName, table))
+	}
+	if minValue, err = parseTimeValue(min.String); err != nil {
+		return minValue, maxValue, err
+	}
+	maxValue, err = parseTimeValue(max.String)
+	return minValue, maxValue, err
+}
+
+// MinSplitInterval is the min split interval, which is the precision of DATETIME(6).
+const MinSplitInterval = time.Microsecond
+
+// countTimeRanges returns the number of ranges of the interval from min to max, aligned to the interval.
+func countTimeRanges(min time.Time, max time.Time, interval time.Duration) int64 {
+	start := min.Truncate(interval)
+	if interval <= 0 || max.Before(start) {
+		return 0
+	}
+	return int64(max.Sub(start)/interval) + 1
+}
+
+// newTimeTransactions creates transactions of the interval from min to max.
+// Ranges are aligned to the interval, like every hour on the hour.
+func newTimeTransactions(min time.Time, max time.Time, interval time.Duration) []*Transaction {
+	transactions := []*Transaction{}
+	id := int64(1)
+	for start := min.Truncate(interval); !start.After(max); start = start.Add(interval) {
+		transactions = append(transactions, &Transaction{
+			id:         id,
+			rangeStart: []interface{}{start},
+			rangeEnd:   []interface{}{start.Add(interval)},
+		})
+		id++
+	}
+	return transactions
+}
+
+// getTimeRangeCondition returns 'column >= start AND column < end' condition and arguments for placeholders.
+// If inline is true, values are embedded in the condition and no arguments are returned.
+func getTimeRangeCondition(columnName string, start time.Time, end time.Time, inline bool) (sqlparser.Expr, []interface{}) {
+	value := func(t time.Time) sqlparser.Expr {
+		if inline {
+			return sqlparser.NewStrVal([]byte(formatTimeValue(t)))
+		}
+		return sqlparser.NewValArg([]byte("?"))
+	}
+	column := &sqlparser.ColName{Name: sqlparser.NewColIdent(columnName)}
+	cond := &sqlparser.AndExpr{
+		Left: &sqlparser.ComparisonExpr{
+			Operator: sqlparser.GreaterEqualStr,
+			Left:     column,
+			Right:    value(start),
+		},
+		Right: &sqlparser.ComparisonExpr{
+			Operator: sqlparser.LessThanStr,
+			Left:     column,
+			Right:    value(end),
+		},
+	}
+	if inline {
+		return cond, nil
+	}
+	return cond, []interface{}{formatTimeValue(start), formatTimeValue(end)}
+}
+
+// newTimeSession creates session data which splits by the interval of temporal column.
+// maxSplitRange is the row limit of Galera Cluster, which cannot be enforced per interval.
+func (sr *Runner) newTimeSession(ctx context.Context, execQuery string, stmt sqlparser.Statement, tableName string, columnName string, columnType string, maxSplitRange int64) (session *Session, err error) {
+	interval := sr.SplitInterval
+	if interval <= 0 {
+		interval = DefaultSplitInterval
+	}
+	if interval < MinSplitInterval {
+		return session, NewInvalidSplitColumnError(columnName,
+			fmt.Sprintf("split interval %s is shorter than %s, the precision of DATETIME(6)", interval, MinSplitInterval))
+	}
+	if strings.ToLower(columnType) == "date" && interval%(24*time.Hour) != 0 {
+		return session, NewInvalidSplitColumnError(columnName,
+			fmt.Sprintf("split interval %s of DATE column must be multiple of 24h", interval))
+	}
+	if sr.TargetChunkTime > 0 {
+		sr.warnf("[%s.%s] Target chunk time is disabled with temporal split column.", sr.DBName, tableName)
+	}
+	if sr.RangeMin != "" || sr.RangeMax != "" {
+		sr.warnf("[%s.%s] The range of the column is ignored with temporal split column.", sr.DBName, tableName)
+	}
+	if maxSplitRange > 0 {
+		sr.warnf("[%s.%s] Galera: rows of each interval are not limited to %d with temporal split column. "+
+			"Use a shorter split interval (--split-interval) if the write set is too large.", sr.DBName, tableName, maxSplitRange)
+	}
+	if err := sr.checkSplitColumnUpdate(stmt, []string{columnName}, sr.isDescending()); err != nil {
+		return session, err
+	}
+
+	min, max, err := sr.getTimeRange(ctx, tableName, columnName)
+	if err != nil {
+		return session, err
+	}
+	sr.debugf("[%s.%s] The column name to split is '%s': min '%s' - max '%s' (every %s)",
+		sr.DBName, tableName, columnName, formatTimeValue(min), formatTimeValue(max), interval)
+
+	if n := countTimeRanges(min, max, interval); n > MaxRangeTransactions {
+		return session, newTooManyRangesError(columnName, n)
+	}
+	transactions := newTimeTransactions(min, max, interval)
+	if sr.UseShuffle {
+		sr.debugf("[%s.%s] This session enable shuffle mode.", sr.DBName, tableName)
+		shuffleTransactions(transactions)
+	} else if sr.UseDescending {
+		sr.debugf("[%s.%s] This session enable descending mode.", sr.DBName, tableName)
+		reverseTransactions(transactions)
+	}
+
+	session = &Session{
+		Query:                   execQuery,
+		DBName:                  sr.DBName,
+		TableName:               tableName,
+		SplittableColumn:        columnName,
+		SplittableColumns:       []string{columnName},
+		SplittableColumnMinTime: min,
+		SplittableColumnMaxTime: max,
+		SplitInterval:           interval,
+		SplitMode:               SplitByTime,
+		stmt:                    stmt,
+		transactions:            transactions,
+		result:                  NewResult(int64(len(transactions))),
+	}
+
+	sr.debugf("[%s.%s] This session executes %d queries.",
+		sr.DBName, tableName, len(session.transactions))
+
+	return session, nil
+}
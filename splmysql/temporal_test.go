@@ -0,0 +1,167 @@
+package splmysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTemporalType(t *testing.T) {
+	assert.True(t, isTemporalType("datetime"))
+	assert.True(t, isTemporalType("DATETIME(6)"))
+	assert.True(t, isTemporalType("date"))
+	assert.True(t, isTemporalType("timestamp"))
+	assert.False(t, isTemporalType("time"))
+	assert.False(t, isTemporalType("year"))
+	assert.False(t, isTemporalType("int(10)"))
+}
+
+func TestFindTemporalColumnForSplit(t *testing.T) {
+	stubInfo := "CREATE TABLE `access_log` (\n" +
+		"  `uuid` char(36) NOT NULL,\n" +
+		"  `updated_at` datetime NOT NULL,\n" +
+		"  `deleted_at` datetime DEFAULT NULL,\n" +
+		"  `created_at` datetime(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),\n" +
+		"  PRIMARY KEY (`uuid`),\n" +
+		"  KEY `idx_deleted_at` (`deleted_at`),\n" +
+		"  KEY `idx_created_at` (`created_at`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8"
+	columnName, columnType := findTemporalColumnForSplit(stubInfo)
+	assert.Equal(t, "created_at", columnName)
+	assert.Equal(t, "datetime(6)", columnType)
+
+	// not indexed
+	stubInfo = "CREATE TABLE `access_log` (\n" +
+		"  `uuid` char(36) NOT NULL,\n" +
+		"  `created_at` date NOT NULL,\n" +
+		"  PRIMARY KEY (`uuid`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8"
+	columnName, _ = findTemporalColumnForSplit(stubInfo)
+	assert.Equal(t, "", columnName)
+}
+
+func TestTimeValue(t *testing.T) {
+	for _, s := range []string{"2018-01-02 03:04:05", "2018-01-02 03:04:05.123456"} {
+		v, err := parseTimeValue(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, s, formatTimeValue(v))
+	}
+	v, err := parseTimeValue("2018-01-02")
+	assert.Nil(t, err)
+	assert.Equal(t, "2018-01-02 00:00:00", formatTimeValue(v))
+	v, err = parseTimeValue("2018-01-02T03:04:05+09:00")
+	assert.Nil(t, err)
+	assert.Equal(t, "2018-01-02 03:04:05", formatTimeValue(v))
+
+	_, err = parseTimeValue("0000-00-00 00:00:00")
+	assert.NotNil(t, err)
+}
+
+func TestNewTimeTransactions(t *testing.T) {
+	min := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	max := time.Date(2018, 1, 2, 5, 0, 0, 0, time.UTC)
+	transactions := newTimeTransactions(min, max, time.Hour)
+	assert.Equal(t, 3, len(transactions))
+	assert.Equal(t, []interface{}{time.Date(2018, 1, 2, 3, 0, 0, 0, time.UTC)}, transactions[0].rangeStart)
+	assert.Equal(t, []interface{}{time.Date(2018, 1, 2, 4, 0, 0, 0, time.UTC)}, transactions[0].rangeEnd)
+	// max is included in the last half-open range.
+	assert.Equal(t, []interface{}{time.Date(2018, 1, 2, 5, 0, 0, 0, time.UTC)}, transactions[2].rangeStart)
+	assert.Equal(t, []interface{}{time.Date(2018, 1, 2, 6, 0, 0, 0, time.UTC)}, transactions[2].rangeEnd)
+	assert.Equal(t, int64(3), transactions[2].id)
+
+	transactions = newTimeTransactions(min, min, 24*time.Hour)
+	assert.Equal(t, 1, len(transactions))
+	assert.Equal(t, []interface{}{time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC)}, transactions[0].rangeStart)
+}
+
+func newTestTimeSession(t *testing.T) *Session {
+	stmt, err := parseQuery("DELETE FROM access_log WHERE code = 404")
+	assert.Nil(t, err)
+	min := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	max := time.Date(2018, 1, 2, 5, 0, 0, 0, time.UTC)
+	transactions := newTimeTransactions(min, max, time.Hour)
+	return &Session{
+		Query:                   "DELETE FROM access_log WHERE code = 404",
+		DBName:                  "db",
+		TableName:               "access_log",
+		SplittableColumn:        "created_at",
+		SplittableColumns:       []string{"created_at"},
+		SplittableColumnMinTime: min,
+		SplittableColumnMaxTime: max,
+		SplitInterval:           time.Hour,
+		SplitMode:               SplitByTime,
+		stmt:                    stmt,
+		transactions:            transactions,
+		result:                  NewResult(int64(len(transactions))),
+	}
+}
+
+func TestTimeSessionSQL(t *testing.T) {
+	sess := newTestTimeSession(t)
+	tx := sess.transactions[0]
+
+	sql, args := sess.getSplittedSQL(tx)
+	assert.Equal(t, "delete from access_log where (code = 404) and (created_at >= ? and created_at < ?)", sql)
+	assert.Equal(t, []interface{}{"2018-01-02 03:00:00", "2018-01-02 04:00:00"}, args)
+
+	assert.Equal(t, "delete from access_log where (code = 404) and "+
+		"(created_at >= '2018-01-02 03:00:00' and created_at < '2018-01-02 04:00:00')", sess.getInlineSQL(tx))
+	assert.Equal(t, "created_at >= '2018-01-02 03:00:00' and created_at < '2018-01-02 04:00:00'",
+		sess.getRangeDescription(tx))
+}
+
+func TestSaveAndResumeTimeSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "splmysql")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	sess := newTestTimeSession(t)
+	sess.finishTransaction(sess.transactions[0], nil)
+	assert.Nil(t, sess.SaveState(path))
+
+	sr := newRunner("db")
+	resumed, err := sr.ResumeSession(path)
+	assert.Nil(t, err)
+	assert.Equal(t, SplitByTime, resumed.SplitMode)
+	assert.Equal(t, time.Hour, resumed.SplitInterval)
+	assert.True(t, sess.SplittableColumnMinTime.Equal(resumed.SplittableColumnMinTime))
+	assert.Equal(t, 2, len(resumed.transactions))
+	assert.Equal(t, "created_at >= '2018-01-02 04:00:00' and created_at < '2018-01-02 05:00:00'",
+		resumed.getRangeDescription(resumed.transactions[0]))
+}
+
+func TestNewTimeSessionRefused(t *testing.T) {
+	db := openStubDB(t, map[string]stubResult{
+		"SELECT MIN(created_at), MAX(created_at) FROM access_log": {rows: [][]driver.Value{{"2000-01-01 00:00:00", "2020-01-01 00:00:00"}}},
+	})
+	defer db.Close()
+	sr := newRunner("db")
+	sr.db = db
+	stmt, err := parseQuery("DELETE FROM access_log")
+	assert.Nil(t, err)
+	newSession := func(interval time.Duration) error {
+		sr.SplitInterval = interval
+		_, err := sr.newTimeSession(context.Background(), "DELETE FROM access_log", stmt, "access_log", "created_at", "datetime", 0)
+		return err
+	}
+
+	// shorter than the precision of DATETIME(6)
+	err = newSession(time.Nanosecond)
+	assert.IsType(t, &InvalidSplitColumnError{}, err)
+	assert.Contains(t, err.Error(), "shorter than 1µs")
+
+	// 20 years every second makes too many queries.
+	err = newSession(time.Second)
+	assert.IsType(t, &InvalidSplitColumnError{}, err)
+	assert.Contains(t, err.Error(), "the range makes 631152001 queries (max 1000000)")
+
+	assert.Nil(t, newSession(24*time.Hour))
+	assert.Equal(t, int64(7306), countTimeRanges(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), 24*time.Hour))
+}
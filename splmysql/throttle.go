@@ -0,0 +1,87 @@
+package splmysql
+
+/*
+Throttling pauses dispatching new transactions while the servers are busy,
+like pt-online-schema-change's '--max-lag'.
+*/
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultThrottleInterval is the interval to check throttlers.
+const DefaultThrottleInterval = time.Second
+
+// Throttler checks the servers before dispatching new transactions.
+type Throttler interface {
+	// Check returns the reason to pause dispatching, or empty string to continue.
+	// If it returns an error, the session is aborted.
+	Check(ctx context.Context) (reason string, err error)
+}
+
+// throttleState keeps the state of throttling in a session.
+type throttleState struct {
+	sr        *Runner
+	sess      *Session
+	lastCheck time.Time
+	pausedAt  time.Time
+}
+
+func (sr *Runner) getThrottleInterval() time.Duration {
+	if sr.ThrottleInterval > 0 {
+		return sr.ThrottleInterval
+	}
+	return DefaultThrottleInterval
+}
+
+// checkThrottlers returns the first reason to pause of throttlers.
+func (sr *Runner) checkThrottlers(ctx context.Context) (reason string, err error) {
+	for _, t := range sr.Throttlers {
+		if reason, err = t.Check(ctx); err != nil || reason != "" {
+			return reason, err
+		}
+	}
+	return "", nil
+}
+
+// wait blocks while any throttler asks to pause, or until ctx is done.
+// Throttlers are checked once per interval at most.
+func (ts *throttleState) wait(ctx context.Context) error {
+	if len(ts.sr.Throttlers) == 0 {
+		return nil
+	}
+	interval := ts.sr.getThrottleInterval()
+	for {
+		paused := ts.sess.GetThrottleReason() != ""
+		if !paused && time.Since(ts.lastCheck) < interval {
+			return nil
+		}
+
+		reason, err := ts.sr.checkThrottlers(ctx)
+		ts.lastCheck = time.Now()
+		if err != nil {
+			return err
+		}
+		ts.sess.setThrottleReason(reason)
+		if reason == "" {
+			if paused {
+				ts.sr.warnf("[%s.%s] Resume dispatching queries after %s.",
+					ts.sess.DBName, ts.sess.TableName, time.Since(ts.pausedAt).Round(time.Second))
+			}
+			return nil
+		}
+		if !paused {
+			ts.pausedAt = time.Now()
+			ts.sr.warnf("[%s.%s] Pause dispatching queries: %s", ts.sess.DBName, ts.sess.TableName, reason)
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package splmysql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pauseThrottler pauses n times, then continues.
+type pauseThrottler struct {
+	n       int
+	checked int
+	err     error
+}
+
+func (t *pauseThrottler) Check(ctx context.Context) (string, error) {
+	t.checked++
+	if t.err != nil {
+		return "", t.err
+	}
+	if t.checked <= t.n {
+		return "busy", nil
+	}
+	return "", nil
+}
+
+func TestThrottleWait(t *testing.T) {
+	sr := newRunner("db")
+	sr.ThrottleInterval = time.Millisecond
+	throttler := &pauseThrottler{n: 3}
+	sr.Throttlers = []Throttler{throttler}
+	sess := &Session{}
+
+	ts := &throttleState{sr: &sr, sess: sess}
+	assert.Nil(t, ts.wait(context.Background()))
+	assert.Equal(t, 4, throttler.checked)
+	assert.Equal(t, "", sess.GetThrottleReason())
+
+	// not checked again in the interval
+	sr.ThrottleInterval = time.Hour
+	assert.Nil(t, ts.wait(context.Background()))
+	assert.Equal(t, 4, throttler.checked)
+}
+
+func TestThrottleWaitCanceled(t *testing.T) {
+	sr := newRunner("db")
+	sr.ThrottleInterval = time.Hour
+	sr.Throttlers = []Throttler{&pauseThrottler{n: 1}}
+	sess := &Session{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ts := &throttleState{sr: &sr, sess: sess}
+	assert.Nil(t, ts.wait(ctx))
+	assert.Equal(t, "busy", sess.GetThrottleReason())
+}
+
+func TestThrottleWaitAbort(t *testing.T) {
+	sr := newRunner("db")
+	abort := errors.New("abort")
+	sr.Throttlers = []Throttler{&pauseThrottler{}, &pauseThrottler{err: abort}}
+
+	ts := &throttleState{sr: &sr, sess: &Session{}}
+	assert.Equal(t, abort, ts.wait(context.Background()))
+}
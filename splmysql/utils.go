@@ -9,40 +9,419 @@ import (
 	"math/rand"
 	"regexp"
 	"strings"
+
+	"github.com/xwb1989/sqlparser"
 )
 
-func sqlIncludesWhere(sql string) bool {
-	regexWhere := regexp.MustCompile(`\bwhere\b`)
-	if regexWhere.FindStringIndex(strings.ToLower(sql)) != nil {
-		return true
+// queryModifiers are the modifiers after the keyword of each statement, which sqlparser does not support.
+var queryModifiers = map[string][]string{
+	"update":  {"low_priority", "ignore"},
+	"delete":  {"low_priority", "quick", "ignore"},
+	"insert":  {"low_priority", "delayed", "high_priority", "ignore"},
+	"replace": {"low_priority", "delayed"},
+}
+
+// parseQuery parses the query into MySQL statement AST.
+// Modifiers like 'UPDATE LOW_PRIORITY IGNORE' are stripped before parsing, and kept in the comments
+// of the statement, which are printed right after the keyword.
+func parseQuery(sql string) (sqlparser.Statement, error) {
+	query, modifiers := stripModifiers(strings.Trim(sql, " ;"))
+	stmt, err := sqlparser.Parse(query)
+	if err != nil {
+		if reason := getUnsupportedSyntax(query); reason != "" {
+			return nil, fmt.Errorf("unsupported syntax, %s: %s", reason, err.Error())
+		}
+		return nil, err
+	}
+	if len(modifiers) > 0 {
+		comment := []byte(strings.Join(modifiers, " "))
+		switch s := stmt.(type) {
+		case *sqlparser.Update:
+			s.Comments = append(s.Comments, comment)
+		case *sqlparser.Delete:
+			s.Comments = append(s.Comments, comment)
+		case *sqlparser.Insert:
+			s.Comments = append(s.Comments, comment)
+		}
+	}
+	return stmt, nil
+}
+
+// stripModifiers removes the modifiers after the keyword of the statement, like LOW_PRIORITY and IGNORE.
+// Otherwise 'UPDATE LOW_PRIORITY t SET ...' is parsed as the table 'low_priority' with alias 't'.
+func stripModifiers(sql string) (query string, modifiers []string) {
+	// leading comments and the keyword
+	reKeyword := regexp.MustCompile(`(?is)^(?:\s|/\*.*?\*/)*([a-z]+)`)
+	reWord := regexp.MustCompile(`(?is)^(?:\s|/\*.*?\*/)+([a-z_]+)(\s|$)`)
+	loc := reKeyword.FindStringSubmatchIndex(sql)
+	if loc == nil {
+		return sql, nil
+	}
+	allowed := queryModifiers[strings.ToLower(sql[loc[2]:loc[3]])]
+	rest := sql[loc[1]:]
+	for {
+		m := reWord.FindStringSubmatchIndex(rest)
+		if m == nil || !containsString(allowed, strings.ToLower(rest[m[2]:m[3]])) {
+			break
+		}
+		// comments between modifiers are kept.
+		modifiers = append(modifiers, strings.ToLower(rest[m[2]:m[3]]))
+		rest = rest[:m[2]] + rest[m[3]:]
+	}
+	return sql[:loc[1]] + rest, modifiers
+}
+
+// getUnsupportedSyntax returns the description of MySQL syntax which sqlparser cannot parse, if the query has it.
+func getUnsupportedSyntax(sql string) string {
+	if regexp.MustCompile(`(?is)^(?:\s|/\*.*?\*/)*with\s`).MatchString(sql) {
+		return "WITH clause (common table expression) is not supported"
+	}
+	if regexp.MustCompile(`(?i)(^|[^\w'"])_[a-z0-9]+\s*'`).MatchString(sql) {
+		return "charset introducer like _utf8mb4'...' is not supported"
+	}
+	return ""
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
 	}
 	return false
 }
 
+// isUpdateQuery checks statement type only, without parsing whole query.
 func isUpdateQuery(sql string) bool {
-	re := regexp.MustCompile(`^\s*update\s+.+\s+set\s.+$`)
-	return re.MatchString(strings.ToLower(sql))
+	return sqlparser.Preview(sql) == sqlparser.StmtUpdate
+}
+
+// isDeleteQuery checks statement type only, without parsing whole query.
+func isDeleteQuery(sql string) bool {
+	return sqlparser.Preview(sql) == sqlparser.StmtDelete
+}
+
+// isInsertQuery checks statement type only, without parsing whole query.
+// It's true for both of INSERT and REPLACE.
+func isInsertQuery(sql string) bool {
+	switch sqlparser.Preview(sql) {
+	case sqlparser.StmtInsert, sqlparser.StmtReplace:
+		return true
+	}
+	return false
+}
+
+// getInsertSelect returns SELECT statement of 'INSERT ... SELECT' or 'REPLACE ... SELECT'.
+// It returns nil for 'INSERT ... VALUES' or SELECT with UNION.
+func getInsertSelect(stmt sqlparser.Statement) *sqlparser.Select {
+	insert, ok := stmt.(*sqlparser.Insert)
+	if !ok {
+		return nil
+	}
+	sel, _ := insert.Rows.(*sqlparser.Select)
+	return sel
 }
 
 func isLimitedQuery(sql string) bool {
-	re := regexp.MustCompile(`^\s*.+limit\s+[0-9]+;?$`)
-	return re.MatchString(strings.ToLower(sql))
+	stmt, err := parseQuery(sql)
+	if err != nil {
+		return false
+	}
+	switch s := stmt.(type) {
+	case *sqlparser.Update:
+		return s.Limit != nil
+	case *sqlparser.Delete:
+		return s.Limit != nil
+	case *sqlparser.Insert:
+		sel := getInsertSelect(s)
+		return sel != nil && sel.Limit != nil
+	}
+	return false
+}
+
+// getSingleTableName returns table name if table expressions have only one table.
+func getSingleTableName(tableExprs sqlparser.TableExprs) string {
+	if len(tableExprs) != 1 {
+		return ""
+	}
+	aliased, ok := tableExprs[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return ""
+	}
+	tableName, ok := aliased.Expr.(sqlparser.TableName)
+	if !ok {
+		return ""
+	}
+	return sqlparser.String(tableName)
+}
+
+// tableRef is a table referred in table expressions, with its alias.
+type tableRef struct {
+	name  sqlparser.TableName
+	alias sqlparser.TableIdent
+}
+
+// qualifier returns the alias of the table, or its name if it has no alias,
+// to qualify the columns of the table in multi-table statements.
+func (ref tableRef) qualifier() sqlparser.TableName {
+	if !ref.alias.IsEmpty() {
+		return sqlparser.TableName{Name: ref.alias}
+	}
+	return ref.name
+}
+
+// matches returns true if name is the alias or the name of the table, like 'o', 'orders' or 'db.orders'.
+func (ref tableRef) matches(name string) bool {
+	if parts := strings.SplitN(name, ".", 2); len(parts) == 2 {
+		return sqlparser.String(ref.name) == sqlparser.String(sqlparser.TableName{
+			Qualifier: sqlparser.NewTableIdent(parts[0]),
+			Name:      sqlparser.NewTableIdent(parts[1]),
+		})
+	}
+	ident := sqlparser.String(sqlparser.NewTableIdent(name))
+	return ident == sqlparser.String(ref.alias) || ident == sqlparser.String(ref.name.Name)
+}
+
+// getTableRefs returns the tables referred in table expressions in order, including joined tables.
+// Derived tables (subqueries) are not included, because they are not splittable.
+func getTableRefs(tableExprs sqlparser.TableExprs) (refs []tableRef) {
+	for _, tableExpr := range tableExprs {
+		switch expr := tableExpr.(type) {
+		case *sqlparser.AliasedTableExpr:
+			if tableName, ok := expr.Expr.(sqlparser.TableName); ok {
+				refs = append(refs, tableRef{name: tableName, alias: expr.As})
+			}
+		case *sqlparser.JoinTableExpr:
+			refs = append(refs, getTableRefs(sqlparser.TableExprs{expr.LeftExpr, expr.RightExpr})...)
+		case *sqlparser.ParenTableExpr:
+			refs = append(refs, getTableRefs(expr.Exprs)...)
+		}
+	}
+	return refs
+}
+
+// getDrivingTable returns the table to split the UPDATE statement, or the SELECT of 'INSERT ... SELECT' by.
+// If splitTable is empty, it's the table of the first column in SET clause, or the first table.
+// multi is true if the statement has multiple tables (or derived tables), and columns must be qualified.
+func getDrivingTable(stmt sqlparser.Statement, splitTable string) (ref tableRef, multi bool, err error) {
+	var tableExprs sqlparser.TableExprs
+	var updateExprs sqlparser.UpdateExprs
+	switch s := stmt.(type) {
+	case *sqlparser.Update:
+		tableExprs, updateExprs = s.TableExprs, s.Exprs
+	case *sqlparser.Insert:
+		sel := getInsertSelect(s)
+		if sel == nil {
+			return ref, false, fmt.Errorf("only 'INSERT ... SELECT' or 'REPLACE ... SELECT' without UNION can be split")
+		}
+		tableExprs = sel.From
+	default:
+		return ref, false, fmt.Errorf("query is not UPDATE or INSERT ... SELECT")
+	}
+	refs := getTableRefs(tableExprs)
+	if len(refs) == 0 {
+		return ref, false, fmt.Errorf("no table to split by in the query")
+	}
+	multi = getSingleTableName(tableExprs) == ""
+
+	if splitTable != "" {
+		found := []tableRef{}
+		for _, r := range refs {
+			if r.matches(splitTable) {
+				found = append(found, r)
+			}
+		}
+		switch len(found) {
+		case 0:
+			return ref, multi, fmt.Errorf("table '%s' is not found in the query", splitTable)
+		case 1:
+			return found[0], multi, nil
+		}
+		return ref, multi, fmt.Errorf("table '%s' is ambiguous in the query, use its alias", splitTable)
+	}
+
+	// the table of the first column in SET clause, like 'o' of 'SET o.x = u.y'.
+	if len(updateExprs) > 0 {
+		if qualifier := updateExprs[0].Name.Qualifier; !qualifier.IsEmpty() {
+			for _, r := range refs {
+				if sqlparser.String(r.qualifier()) == sqlparser.String(qualifier) {
+					return r, multi, nil
+				}
+			}
+		}
+	}
+	return refs[0], multi, nil
 }
 
 func getUpdateTableName(sql string) string {
-	re := regexp.MustCompile(`^\s*update\s+(.+)\s+set\s.+$`)
-	s := re.ReplaceAllString(strings.ToLower(sql), "$1")
-	if strings.Index(s, ",") < 0 {
-		return strings.Trim(s, " ")
+	stmt, err := parseQuery(sql)
+	if err != nil {
+		return ""
+	}
+	update, ok := stmt.(*sqlparser.Update)
+	if !ok {
+		return ""
+	}
+	return getSingleTableName(update.TableExprs)
+}
+
+func getDeleteTableName(sql string) string {
+	stmt, err := parseQuery(sql)
+	if err != nil {
+		return ""
+	}
+	del, ok := stmt.(*sqlparser.Delete)
+	if !ok || len(del.Targets) > 0 {
+		// multi-table syntax: DELETE t1, t2 FROM ...
+		return ""
+	}
+	return getSingleTableName(del.TableExprs)
+}
+
+// addWhereCondition returns new WHERE clause which has cond in addition to where.
+// Both of conditions are wrapped with parentheses as '(original) and (cond)',
+// because the printer of AST does not care about operator precedence.
+func addWhereCondition(where *sqlparser.Where, cond sqlparser.Expr) *sqlparser.Where {
+	if where == nil || where.Expr == nil {
+		return sqlparser.NewWhere(sqlparser.WhereStr, cond)
+	}
+	return sqlparser.NewWhere(sqlparser.WhereStr, &sqlparser.AndExpr{
+		Left:  parenthesize(where.Expr),
+		Right: parenthesize(cond),
+	})
+}
+
+func parenthesize(expr sqlparser.Expr) sqlparser.Expr {
+	if _, ok := expr.(*sqlparser.ParenExpr); ok {
+		return expr
+	}
+	return &sqlparser.ParenExpr{Expr: expr}
+}
+
+// getSplittedUpdateSQL adds range condition into statement AST and returns the SQL.
+// The statement itself is not modified.
+func getSplittedUpdateSQL(stmt sqlparser.Statement, splitColumnName string, start int64, end int64) string {
+	return addRangeCondition(stmt, getRangeCondition(splitColumnName, start, end))
+}
+
+// getRangeCondition returns 'column BETWEEN start AND end' condition.
+func getRangeCondition(splitColumnName string, start int64, end int64) sqlparser.Expr {
+	return getValueRangeCondition(splitColumnName, start, end)
+}
+
+// addRangeCondition returns SQL of the statement which has cond in WHERE clause.
+func addRangeCondition(stmt sqlparser.Statement, cond sqlparser.Expr) string {
+	switch s := stmt.(type) {
+	case *sqlparser.Update:
+		update := *s
+		update.Where = addWhereCondition(s.Where, cond)
+		return sqlparser.String(&update)
+	case *sqlparser.Delete:
+		del := *s
+		del.Where = addWhereCondition(s.Where, cond)
+		return sqlparser.String(&del)
+	case *sqlparser.Insert:
+		// the condition is added to the SELECT which reads the source table.
+		sel := getInsertSelect(s)
+		if sel == nil {
+			return ""
+		}
+		insert, selCopy := *s, *sel
+		selCopy.Where = addWhereCondition(sel.Where, cond)
+		insert.Rows = &selCopy
+		return sqlparser.String(&insert)
 	}
 	return ""
 }
 
-func getSplittedUpdateSQL(originalSQL string, splitColumnName string, start int64, end int64) string {
-	if sqlIncludesWhere(originalSQL) {
-		return fmt.Sprintf("%s and %s between %d and %d", originalSQL, splitColumnName, start, end)
+// qualifyColumns qualifies all columns in expr with the table name or alias, for multi-table statements.
+func qualifyColumns(expr sqlparser.Expr, qualifier sqlparser.TableName) sqlparser.Expr {
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if col, ok := node.(*sqlparser.ColName); ok {
+			col.Qualifier = qualifier
+		}
+		return true, nil
+	}, expr)
+	return expr
+}
+
+// checkInsertAggregation returns error if INSERT ... SELECT aggregates rows with GROUP BY, DISTINCT,
+// aggregate functions or HAVING, because each chunk is aggregated separately.
+// It's allowed if GROUP BY includes all the split columns of the table, because each group is in a chunk.
+func checkInsertAggregation(stmt sqlparser.Statement, ref tableRef, columnNames []string) error {
+	sel := getInsertSelect(stmt)
+	if sel == nil {
+		return nil
+	}
+	if len(sel.GroupBy) == 0 && sel.Distinct == "" && sel.Having == nil && !hasAggregate(sel.SelectExprs) {
+		return nil
+	}
+	for _, name := range columnNames {
+		if !isGroupedBy(sel.GroupBy, ref, name) {
+			return fmt.Errorf("INSERT ... SELECT with GROUP BY, DISTINCT, aggregate functions or HAVING "+
+				"can be split only if GROUP BY includes the split column '%s'", name)
+		}
+	}
+	return nil
+}
+
+// hasAggregate returns true if the expressions have aggregate functions, except in subqueries.
+func hasAggregate(exprs sqlparser.SelectExprs) bool {
+	found := false
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch n := node.(type) {
+		case *sqlparser.Subquery:
+			return false, nil
+		case *sqlparser.FuncExpr:
+			found = found || n.IsAggregate()
+		case *sqlparser.GroupConcatExpr:
+			found = true
+		}
+		return !found, nil
+	}, exprs)
+	return found
+}
+
+// isGroupedBy returns true if GROUP BY has the column of the table.
+func isGroupedBy(groupBy sqlparser.GroupBy, ref tableRef, columnName string) bool {
+	for _, expr := range groupBy {
+		col, ok := expr.(*sqlparser.ColName)
+		if !ok || !col.Name.EqualString(columnName) {
+			continue
+		}
+		if col.Qualifier.IsEmpty() || ref.matches(sqlparser.String(col.Qualifier)) {
+			return true
+		}
+	}
+	return false
+}
+
+// getAssignedColumn returns the column of columnNames first assigned in SET clause of UPDATE statement.
+// If qualifier is not empty, the columns qualified with other tables are ignored.
+func getAssignedColumn(stmt sqlparser.Statement, qualifier sqlparser.TableName, columnNames []string) string {
+	update, ok := stmt.(*sqlparser.Update)
+	if !ok {
+		return ""
+	}
+	for _, expr := range update.Exprs {
+		if !qualifier.IsEmpty() && !expr.Name.Qualifier.IsEmpty() &&
+			sqlparser.String(expr.Name.Qualifier) != sqlparser.String(qualifier) {
+			continue
+		}
+		for _, name := range columnNames {
+			if expr.Name.Name.EqualString(name) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// reverseTransactions reverses the order of transactions, to execute from the max value.
+func reverseTransactions(transactions []*Transaction) {
+	for i, j := 0, len(transactions)-1; i < j; i, j = i+1, j-1 {
+		transactions[i], transactions[j] = transactions[j], transactions[i]
 	}
-	return fmt.Sprintf("%s where %s between %d and %d", originalSQL, splitColumnName, start, end)
 }
 
 func shuffleTransactions(transactions []*Transaction) {
@@ -55,10 +434,8 @@ func shuffleTransactions(transactions []*Transaction) {
 
 func isIntegerType(typeName string) bool {
 	typeName = strings.ToLower(strings.Trim(typeName, " "))
-	if strings.Index(typeName, "int") >= 0 {
-		return true
-	}
-	return false
+	reInteger := regexp.MustCompile(`^(tinyint|smallint|mediumint|int|integer|bigint)(\(\d+\))?(\s+(unsigned|zerofill))*$`)
+	return reInteger.MatchString(typeName)
 }
 
 // findColumnNameForSplit parses 'SHOW CREATE TABLE' info and get column name for split
@@ -113,6 +490,57 @@ func parseSinglePrimaryKeyInfo(info string) (columnName string) {
 	return ""
 }
 
+// parseKeysetPrimaryKeyInfo parses Primary Key info for keyset split.
+// All of the columns must be integer, string or binary type. Column names are returned in index order.
+func parseKeysetPrimaryKeyInfo(info string) (columnNames []string, kinds []keyKind) {
+	var pkColumnNames []string
+	//	PRIMARY KEY (`tenant_id`,`id`),\n
+	rePKInfo := regexp.MustCompile(`^.*\sprimary\s+key\s*\((.+)\).*$`)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.ToLower(line)
+		if !rePKInfo.MatchString(line) {
+			continue
+		}
+		for _, s := range strings.Split(rePKInfo.ReplaceAllString(line, "$1"), ",") {
+			// prefix index like `uuid`(8) is not found in columns, and not usable.
+			pkColumnNames = append(pkColumnNames, strings.Trim(s, " `'\""))
+		}
+		break
+	}
+	if len(pkColumnNames) == 0 {
+		return nil, nil
+	}
+
+	// `tenant_id` int(10) unsigned NOT NULL,\n
+	// `uuid` binary(16) NOT NULL,\n
+	reColumn := regexp.MustCompile(
+		`^.*\s[` + "`" + `'"]([^` + "`" + `'"]+)[` + "`" + `'"]` + // `tenant_id`
+			`\s+([^\s]+)(\s.*)?` + // `int(10) unsigned`
+			`\snot\s+null.*$`) // NOT NULL
+	columnKinds := map[string]keyKind{}
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.ToLower(line)
+		if !reColumn.MatchString(line) {
+			continue
+		}
+		if kind, ok := getKeyKind(reColumn.ReplaceAllString(line, "$2")); ok {
+			if kind == keyInt && isUnsignedDefinition(reColumn.ReplaceAllString(line, "$3")) {
+				kind = keyUint
+			}
+			columnKinds[reColumn.ReplaceAllString(line, "$1")] = kind
+		}
+	}
+	for _, s := range pkColumnNames {
+		kind, ok := columnKinds[s]
+		if !ok {
+			return nil, nil
+		}
+		kinds = append(kinds, kind)
+	}
+
+	return pkColumnNames, kinds
+}
+
 // parseSingleUniqueKeyInfo parses single-column Unique Key with 'NOT NULL' statement.
 // a.k.a. multi-columns Unique Key is invalid in this func.
 func parseSingleUniqueKeyInfo(info string) (columnName string) {
@@ -175,3 +603,92 @@ func parseAutoIncrementInfo(info string) (columnName string) {
 
 	return ""
 }
+
+// parseColumnInfo parses the definition of the column.
+// It returns the type of the column and whether it has 'NOT NULL' statement.
+func parseColumnInfo(info string, columnName string) (columnType string, notNull bool, found bool) {
+	// `id` bigint(20) unsigned NOT NULL,\n
+	reColumn := regexp.MustCompile(
+		`^\s*[` + "`" + `'"]([^` + "`" + `'"]+)[` + "`" + `'"]` + // `id`
+			`\s+([^\s,]+)(.*)$`) // bigint(20) unsigned NOT NULL,
+	reNotNull := regexp.MustCompile(`\snot\s+null[\s,]`)
+	columnName = strings.ToLower(columnName)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.ToLower(line)
+		if !reColumn.MatchString(line) || reColumn.ReplaceAllString(line, "$1") != columnName {
+			continue
+		}
+		rest := reColumn.ReplaceAllString(line, "$3") + "\n"
+		return reColumn.ReplaceAllString(line, "$2"), reNotNull.MatchString(rest), true
+	}
+	return "", false, false
+}
+
+// isUnsignedColumn returns true if the column is defined as 'unsigned'.
+func isUnsignedColumn(info string, columnName string) bool {
+	// `id` bigint(20) unsigned NOT NULL,\n
+	reColumn := regexp.MustCompile(
+		`^\s*[` + "`" + `'"]([^` + "`" + `'"]+)[` + "`" + `'"]` + // `id`
+			`\s+[^\s,]+(.*)$`) // bigint(20) unsigned NOT NULL,
+	columnName = strings.ToLower(columnName)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.ToLower(line)
+		if !reColumn.MatchString(line) || reColumn.ReplaceAllString(line, "$1") != columnName {
+			continue
+		}
+		return isUnsignedDefinition(reColumn.ReplaceAllString(line, "$2"))
+	}
+	return false
+}
+
+// isUnsignedDefinition returns true if the column definition after the type has 'unsigned' attribute.
+func isUnsignedDefinition(definition string) bool {
+	return regexp.MustCompile(`(^|\s)unsigned(\s|,|$)`).MatchString(strings.ToLower(definition))
+}
+
+// isIndexedColumn returns true if the column is the first column of any index.
+func isIndexedColumn(info string, columnName string) bool {
+	return len(getIndexNames(info, columnName)) > 0
+}
+
+// getIndexNames returns the lower case names of the indexes which start with the column.
+// The name of Primary Key is 'primary'.
+func getIndexNames(info string, columnName string) (names []string) {
+	//	PRIMARY KEY (`id`),\n
+	//	UNIQUE KEY `uk` (`uk`,`id`),\n
+	//	KEY `idx` (`col`),\n
+	reIndex := regexp.MustCompile(
+		`^\s*(primary\s+|unique\s+)?(key|index)\s*` + // PRIMARY KEY, UNIQUE KEY or KEY
+			`([` + "`" + `'"]([^` + "`" + `'"]+)[` + "`" + `'"])?` + // `idx`
+			`\s*\(\s*[` + "`" + `'"]([^` + "`" + `'"]+)[` + "`" + `'"].*$`) // (`col`
+	columnName = strings.ToLower(columnName)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.ToLower(line)
+		m := reIndex.FindStringSubmatch(line)
+		if m == nil || m[5] != columnName {
+			continue
+		}
+		if strings.HasPrefix(m[1], "primary") {
+			names = append(names, "primary")
+		} else {
+			names = append(names, m[4])
+		}
+	}
+	return names
+}
+
+// checkSplitColumn checks the column given to split by: it exists, is indexed and is integer type.
+// It returns the name of the column in the table definition.
+func checkSplitColumn(info string, columnName string) (string, error) {
+	columnType, _, found := parseColumnInfo(info, columnName)
+	if !found {
+		return "", fmt.Errorf("column not found")
+	}
+	if !isIntegerType(columnType) {
+		return "", fmt.Errorf("column type '%s' is not integer", columnType)
+	}
+	if !isIndexedColumn(info, columnName) {
+		return "", fmt.Errorf("column is not the first column of any index")
+	}
+	return strings.ToLower(columnName), nil
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/xwb1989/sqlparser"
 )
 
 func TestIsUpdateQuery(t *testing.T) {
@@ -24,6 +25,87 @@ func TestIsUpdateQuery(t *testing.T) {
 	assert.True(t, isUpdateQuery(q))
 
 }
+
+func TestIsDeleteQuery(t *testing.T) {
+	var q string
+	q = "DELETE FROM foo;"
+	assert.True(t, isDeleteQuery(q))
+
+	q = "DELETE FROM foo WHERE created_at < '2017-01-01';"
+	assert.True(t, isDeleteQuery(q))
+
+	q = "delete from foo where hey = 'yo'"
+	assert.True(t, isDeleteQuery(q))
+
+	q = "UPDATE foo SET yo = 'hey' WHERE hey = 'yo';"
+	assert.False(t, isDeleteQuery(q))
+
+	q = "/* purge */ DELETE FROM foo WHERE hey = 'yo';"
+	assert.True(t, isDeleteQuery(q))
+}
+
+func TestIsInsertQuery(t *testing.T) {
+	var q string
+	q = "INSERT INTO bar SELECT * FROM foo;"
+	assert.True(t, isInsertQuery(q))
+
+	q = "insert ignore into bar (id, yo) select id, yo from foo where hey = 'yo'"
+	assert.True(t, isInsertQuery(q))
+
+	q = "REPLACE INTO bar SELECT * FROM foo;"
+	assert.True(t, isInsertQuery(q))
+
+	q = "UPDATE foo SET yo = 'hey' WHERE hey = 'yo';"
+	assert.False(t, isInsertQuery(q))
+
+	stmt, err := parseQuery("INSERT INTO bar SELECT * FROM foo")
+	assert.Nil(t, err)
+	assert.NotNil(t, getInsertSelect(stmt))
+	stmt, err = parseQuery("INSERT INTO bar (id, yo) VALUES (1, 'hey')")
+	assert.Nil(t, err)
+	assert.Nil(t, getInsertSelect(stmt))
+	stmt, err = parseQuery("INSERT INTO bar SELECT * FROM foo UNION SELECT * FROM baz")
+	assert.Nil(t, err)
+	assert.Nil(t, getInsertSelect(stmt))
+}
+
+func TestParseQueryModifiers(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{"UPDATE IGNORE t SET a = 1", "update ignore t set a = 1 where id between 1 and 100"},
+		{"UPDATE LOW_PRIORITY t SET a = 1", "update low_priority t set a = 1 where id between 1 and 100"},
+		{"update low_priority ignore t set a = 1", "update low_priority ignore t set a = 1 where id between 1 and 100"},
+		{"DELETE IGNORE FROM t WHERE a = 1", "delete ignore from t where (a = 1) and (id between 1 and 100)"},
+		{"DELETE LOW_PRIORITY QUICK IGNORE FROM t", "delete low_priority quick ignore from t where id between 1 and 100"},
+		{"UPDATE /* backfill */ IGNORE t SET a = 1", "update /* backfill */ ignore t set a = 1 where id between 1 and 100"},
+		{"/* backfill */ UPDATE IGNORE t SET a = 1", "update ignore t set a = 1 where id between 1 and 100"},
+		{"INSERT LOW_PRIORITY IGNORE INTO u SELECT * FROM t", "insert low_priority ignore into u select * from t where id between 1 and 100"},
+		// not modifiers, but the table names.
+		{"UPDATE quick SET a = 1", "update quick set a = 1 where id between 1 and 100"},
+		{"UPDATE ignored SET a = 1", "update ignored set a = 1 where id between 1 and 100"},
+	}
+	for _, c := range cases {
+		stmt, err := parseQuery(c.query)
+		assert.Nil(t, err, c.query)
+		assert.Equal(t, c.expected, getSplittedUpdateSQL(stmt, "id", 1, 100), c.query)
+	}
+
+	assert.Equal(t, "t", getUpdateTableName("UPDATE LOW_PRIORITY t SET a = 1"))
+	assert.Equal(t, "t", getUpdateTableName("UPDATE IGNORE t SET a = 1"))
+	assert.Equal(t, "t", getDeleteTableName("DELETE IGNORE FROM t WHERE a = 1"))
+	assert.True(t, isLimitedQuery("UPDATE IGNORE t SET a = 1 LIMIT 10"))
+
+	// unsupported syntax returns clear error.
+	_, err := parseQuery("UPDATE t SET a = _utf8mb4'x' WHERE b = 1")
+	assert.Contains(t, err.Error(), "unsupported syntax, charset introducer")
+	_, err = parseQuery("WITH c AS (SELECT id FROM u) UPDATE t JOIN c ON t.id = c.id SET a = 1")
+	assert.Contains(t, err.Error(), "unsupported syntax, WITH clause")
+	_, err = parseQuery("UPDATE t SET a = 'x' WHERE")
+	assert.NotContains(t, err.Error(), "unsupported syntax")
+}
+
 func TestIsLimitedQuery(t *testing.T) {
 	var q string
 	q = "UPDATE foo SET yo = 'hey' LIMIT 100;"
@@ -34,6 +116,21 @@ func TestIsLimitedQuery(t *testing.T) {
 
 	q = "update foo set yo = 'limit', hey = 'yo';"
 	assert.False(t, isLimitedQuery(q))
+
+	q = "DELETE FROM foo WHERE hey = 'yo' LIMIT 1000;"
+	assert.True(t, isLimitedQuery(q))
+
+	q = "UPDATE foo SET yo = 'hey' WHERE hey = 'yo limit 10';"
+	assert.False(t, isLimitedQuery(q))
+
+	q = "UPDATE foo SET yo = 'hey' /* limit 10 */;"
+	assert.False(t, isLimitedQuery(q))
+
+	q = "INSERT INTO bar SELECT * FROM foo LIMIT 100;"
+	assert.True(t, isLimitedQuery(q))
+
+	q = "INSERT INTO bar SELECT * FROM foo WHERE id IN (SELECT id FROM baz LIMIT 10);"
+	assert.False(t, isLimitedQuery(q))
 }
 
 func TestGetUpdateTableName(t *testing.T) {
@@ -43,6 +140,116 @@ func TestGetUpdateTableName(t *testing.T) {
 
 	q = "UPDATE items, month SET items.price=month.price WHERE items.id=month.id;"
 	assert.Equal(t, getUpdateTableName(q), "")
+
+	q = "UPDATE `Foo` SET yo = 'where' WHERE hey = 'yo';"
+	assert.Equal(t, getUpdateTableName(q), "Foo")
+
+	q = "UPDATE `db`.`foo` SET yo = 'hey';"
+	assert.Equal(t, getUpdateTableName(q), "db.foo")
+
+	q = "UPDATE `order` SET yo = 'hey';"
+	assert.Equal(t, getUpdateTableName(q), "`order`")
+
+	q = "UPDATE items JOIN month ON items.id=month.id SET items.price=month.price;"
+	assert.Equal(t, getUpdateTableName(q), "")
+}
+
+func TestGetDeleteTableName(t *testing.T) {
+	var q string
+	q = "DELETE FROM foo WHERE created_at < '2017-01-01';"
+	assert.Equal(t, getDeleteTableName(q), "foo")
+
+	q = "DELETE FROM foo"
+	assert.Equal(t, getDeleteTableName(q), "foo")
+
+	q = "DELETE FROM foo, bar USING foo INNER JOIN bar WHERE foo.id = bar.id;"
+	assert.Equal(t, getDeleteTableName(q), "")
+
+	q = "DELETE foo FROM foo INNER JOIN bar ON foo.id = bar.id;"
+	assert.Equal(t, getDeleteTableName(q), "")
+}
+
+func TestParseKeysetPrimaryKeyInfo(t *testing.T) {
+	// Composite Primary Key and types are integer-like.
+	stubInfo := "CREATE TABLE `members` (\n" +
+		"  `tenant_id` int(10) unsigned NOT NULL,\n" +
+		"  `id` bigint(20) NOT NULL,\n" +
+		"  `name` varchar(50) NOT NULL,\n" +
+		"  `location` point NOT NULL,\n" +
+		"  PRIMARY KEY (`tenant_id`,`id`),\n" +
+		"  KEY `name` (`name`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8"
+	columnNames, kinds := parseKeysetPrimaryKeyInfo(stubInfo)
+	assert.Equal(t, []string{"tenant_id", "id"}, columnNames)
+	assert.Equal(t, []keyKind{keyUint, keyInt}, kinds)
+	assert.Equal(t, "", findColumnNameForSplit(stubInfo))
+	assert.Equal(t, []string{"primary"}, getIndexNames(stubInfo, "tenant_id"))
+	assert.Equal(t, []string{"name"}, getIndexNames(stubInfo, "Name"))
+	assert.Nil(t, getIndexNames(stubInfo, "id"))
+
+	// Composite Primary Key includes string column.
+	stubInfo = "CREATE TABLE `members` (\n" +
+		"  `tenant_id` int(10) unsigned NOT NULL,\n" +
+		"  `name` varchar(50) NOT NULL,\n" +
+		"  `location` point NOT NULL,\n" +
+		"  PRIMARY KEY (`tenant_id`,`name`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8"
+	columnNames, kinds = parseKeysetPrimaryKeyInfo(stubInfo)
+	assert.Equal(t, []string{"tenant_id", "name"}, columnNames)
+	assert.Equal(t, []keyKind{keyUint, keyString}, kinds)
+
+	// UUID Primary Keys.
+	stubInfo = "CREATE TABLE `events` (\n" +
+		"  `uuid` char(36) CHARACTER SET ascii NOT NULL,\n" +
+		"  `body` text,\n" +
+		"  PRIMARY KEY (`uuid`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	columnNames, kinds = parseKeysetPrimaryKeyInfo(stubInfo)
+	assert.Equal(t, []string{"uuid"}, columnNames)
+	assert.Equal(t, []keyKind{keyString}, kinds)
+	assert.Equal(t, "", findColumnNameForSplit(stubInfo))
+
+	stubInfo = "CREATE TABLE `events` (\n" +
+		"  `id` binary(16) NOT NULL,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	columnNames, kinds = parseKeysetPrimaryKeyInfo(stubInfo)
+	assert.Equal(t, []string{"id"}, columnNames)
+	assert.Equal(t, []keyKind{keyBytes}, kinds)
+
+	// Primary Key includes not usable column.
+	stubInfo = "CREATE TABLE `members` (\n" +
+		"  `tenant_id` int(10) unsigned NOT NULL,\n" +
+		"  `joined` datetime NOT NULL,\n" +
+		"  PRIMARY KEY (`tenant_id`,`joined`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8"
+	columnNames, _ = parseKeysetPrimaryKeyInfo(stubInfo)
+	assert.Nil(t, columnNames)
+
+	// Prefix index is not usable.
+	stubInfo = "CREATE TABLE `members` (\n" +
+		"  `name` varchar(255) NOT NULL,\n" +
+		"  PRIMARY KEY (`name`(16))\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8"
+	columnNames, _ = parseKeysetPrimaryKeyInfo(stubInfo)
+	assert.Nil(t, columnNames)
+}
+
+func TestGetSplittedUpdateSQL(t *testing.T) {
+	stmt, err := parseQuery("UPDATE foo SET yo = 'Hey WHERE' -- comment")
+	assert.Nil(t, err)
+	assert.Equal(t, "update foo set yo = 'Hey WHERE' where id between 1 and 100",
+		getSplittedUpdateSQL(stmt, "id", 1, 100))
+
+	stmt, err = parseQuery("UPDATE `db`.`foo` SET yo = 'Hey' WHERE hey = 'Yo' ORDER BY id;")
+	assert.Nil(t, err)
+	assert.Equal(t, "update db.foo set yo = 'Hey' where (hey = 'Yo') and (id between 1 and 100) order by id asc",
+		getSplittedUpdateSQL(stmt, "id", 1, 100))
+
+	stmt, err = parseQuery("DELETE FROM foo WHERE created_at < '2017-01-01'")
+	assert.Nil(t, err)
+	assert.Equal(t, "delete from foo where (created_at < '2017-01-01') and (id between 101 and 200)",
+		getSplittedUpdateSQL(stmt, "id", 101, 200))
 }
 
 func TestIsIntegerType(t *testing.T) {
@@ -56,7 +263,15 @@ func TestIsIntegerType(t *testing.T) {
 	assert.True(t, isIntegerType("int"))
 	assert.True(t, isIntegerType("bigint"))
 
+	assert.True(t, isIntegerType("integer"))
+	assert.True(t, isIntegerType("bigint(20)"))
+	assert.True(t, isIntegerType("int(10) unsigned"))
+
 	assert.False(t, isIntegerType("varchar"))
+	assert.False(t, isIntegerType("point"))
+	assert.False(t, isIntegerType("multipoint"))
+	assert.False(t, isIntegerType("linestring"))
+	assert.False(t, isIntegerType("interval"))
 }
 
 func TestFindColumnNameForSplit(t *testing.T) {
@@ -135,3 +350,265 @@ func TestFindColumnNameForSplit(t *testing.T) {
 	assert.Equal(t, columnName, "")
 
 }
+
+func TestGetSplittedUpdateSQLPredicate(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		// OR must not swallow the range condition.
+		{
+			"UPDATE t SET a = 1 WHERE b = 1 OR c = 2",
+			"update t set a = 1 where (b = 1 or c = 2) and (id between 1 and 100)",
+		},
+		{
+			"DELETE FROM t WHERE b = 1 OR c = 2 AND d = 3",
+			"delete from t where (b = 1 or c = 2 and d = 3) and (id between 1 and 100)",
+		},
+		{
+			"UPDATE t SET a = 1 WHERE b = 1 || c = 2",
+			"update t set a = 1 where (b = 1 or c = 2) and (id between 1 and 100)",
+		},
+		// Already parenthesized conditions are not doubled.
+		{
+			"UPDATE t SET a = 1 WHERE (b = 1 OR c = 2)",
+			"update t set a = 1 where (b = 1 or c = 2) and (id between 1 and 100)",
+		},
+		// NOT
+		{
+			"UPDATE t SET a = 1 WHERE NOT b = 1",
+			"update t set a = 1 where (not b = 1) and (id between 1 and 100)",
+		},
+		{
+			"UPDATE t SET a = 1 WHERE NOT (b = 1 OR c = 2)",
+			"update t set a = 1 where (not (b = 1 or c = 2)) and (id between 1 and 100)",
+		},
+		// Subqueries keep their own WHERE clauses.
+		{
+			"UPDATE t SET a = 1 WHERE b IN (SELECT b FROM u WHERE c = 1 OR d = 2)",
+			"update t set a = 1 where (b in (select b from u where c = 1 or d = 2)) and (id between 1 and 100)",
+		},
+		{
+			"DELETE FROM t WHERE EXISTS (SELECT 1 FROM u WHERE u.id = t.uid) OR b = 1",
+			"delete from t where (exists (select 1 from u where u.id = t.uid) or b = 1) and (id between 1 and 100)",
+		},
+		{
+			"UPDATE t SET a = (SELECT MAX(x) FROM u WHERE u.id = 1)",
+			"update t set a = (select MAX(x) from u where u.id = 1) where id between 1 and 100",
+		},
+		// INSERT ... SELECT adds the condition to SELECT.
+		{
+			"INSERT IGNORE INTO bar (id, yo) SELECT id, yo FROM foo WHERE hey = 'yo' OR a = 1",
+			"insert ignore into bar(id, yo) select id, yo from foo where (hey = 'yo' or a = 1) and (id between 1 and 100)",
+		},
+		{
+			"REPLACE INTO bar SELECT * FROM foo",
+			"replace into bar select * from foo where id between 1 and 100",
+		},
+		// Trailing ORDER BY
+		{
+			"UPDATE t SET a = 1 WHERE b = 1 OR c = 2 ORDER BY id DESC",
+			"update t set a = 1 where (b = 1 or c = 2) and (id between 1 and 100) order by id desc",
+		},
+		{
+			"UPDATE t SET a = 1 ORDER BY id",
+			"update t set a = 1 where id between 1 and 100 order by id asc",
+		},
+		{
+			"DELETE FROM t WHERE b = 'or' ORDER BY created_at",
+			"delete from t where (b = 'or') and (id between 1 and 100) order by created_at asc",
+		},
+	}
+	for _, c := range cases {
+		stmt, err := parseQuery(c.query)
+		assert.Nil(t, err, c.query)
+		assert.Equal(t, c.expected, getSplittedUpdateSQL(stmt, "id", 1, 100), c.query)
+	}
+
+	// INSERT ... SELECT aggregated across the chunks is refused.
+	for _, query := range []string{
+		"INSERT INTO bar SELECT yo, COUNT(*) FROM foo GROUP BY yo ON DUPLICATE KEY UPDATE cnt = VALUES(cnt)",
+		"INSERT INTO bar SELECT COUNT(*) FROM foo",
+		"INSERT INTO bar SELECT DISTINCT yo FROM foo",
+		"REPLACE INTO bar SELECT yo, GROUP_CONCAT(id) FROM foo",
+		"INSERT INTO bar SELECT f.yo, SUM(f.x) FROM foo f JOIN baz b ON b.id = f.id GROUP BY f.yo, b.id",
+	} {
+		stmt, err := parseQuery(query)
+		assert.Nil(t, err, query)
+		ref, _, err := getDrivingTable(stmt, "")
+		assert.Nil(t, err, query)
+		assert.NotNil(t, checkInsertAggregation(stmt, ref, []string{"id"}), query)
+	}
+	// each group is in a chunk if GROUP BY includes the split column.
+	for _, query := range []string{
+		"INSERT INTO bar SELECT id, COUNT(*) FROM foo GROUP BY id ON DUPLICATE KEY UPDATE cnt = VALUES(cnt)",
+		"INSERT INTO bar SELECT f.id, SUM(b.x) FROM foo f JOIN baz b ON b.id = f.id GROUP BY f.yo, f.id",
+		"INSERT INTO bar SELECT id, (SELECT MAX(x) FROM baz) FROM foo",
+		"INSERT INTO bar SELECT id, yo FROM foo",
+	} {
+		stmt, err := parseQuery(query)
+		assert.Nil(t, err, query)
+		ref, _, err := getDrivingTable(stmt, "")
+		assert.Nil(t, err, query)
+		assert.Nil(t, checkInsertAggregation(stmt, ref, []string{"id"}), query)
+	}
+}
+
+func TestGetAssignedColumn(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{"UPDATE t SET id = id + 1000000 WHERE a = 1", "id"},
+		{"UPDATE t SET b = 1, t.ID = 2", "id"},
+		{"UPDATE t SET b = id + 1 WHERE id > 1", ""},
+		{"UPDATE t SET b = 2, a = 1", "a"},
+		{"DELETE FROM t WHERE id = 1", ""},
+	}
+	for _, c := range cases {
+		stmt, err := parseQuery(c.query)
+		assert.Nil(t, err, c.query)
+		assert.Equal(t, c.expected, getAssignedColumn(stmt, sqlparser.TableName{}, []string{"id", "a"}), c.query)
+	}
+
+	// columns of other tables are ignored in multi-table UPDATE.
+	qualifier := sqlparser.TableName{Name: sqlparser.NewTableIdent("o")}
+	stmt, err := parseQuery("UPDATE orders o JOIN users u ON o.user_id = u.id SET u.id = 1, o.b = 2")
+	assert.Nil(t, err)
+	assert.Equal(t, "", getAssignedColumn(stmt, qualifier, []string{"id"}))
+	stmt, err = parseQuery("UPDATE orders o JOIN users u ON o.user_id = u.id SET u.b = 1, o.id = 2")
+	assert.Nil(t, err)
+	assert.Equal(t, "id", getAssignedColumn(stmt, qualifier, []string{"id"}))
+}
+
+func TestGetDrivingTable(t *testing.T) {
+	cases := []struct {
+		query      string
+		splitTable string
+		table      string
+		qualifier  string
+		multi      bool
+		err        string
+	}{
+		{"UPDATE foo SET yo = 'hey'", "", "foo", "foo", false, ""},
+		{"UPDATE `db`.`foo` f SET f.yo = 'hey'", "", "db.foo", "f", false, ""},
+		// the table of the first column in SET clause.
+		{"UPDATE orders o JOIN users u ON o.user_id = u.id SET o.x = u.y", "", "orders", "o", true, ""},
+		{"UPDATE users u JOIN orders o ON o.user_id = u.id SET o.x = u.y", "", "orders", "o", true, ""},
+		{"UPDATE items, month SET items.price=month.price WHERE items.id=month.id", "", "items", "items", true, ""},
+		{"UPDATE items, month SET price = month.price WHERE items.id = month.id", "", "items", "items", true, ""},
+		{"UPDATE (orders o JOIN users u ON o.user_id = u.id) LEFT JOIN logs l ON l.id = o.id SET l.x = 1", "", "logs", "l", true, ""},
+		{"UPDATE orders o JOIN (SELECT id FROM users) u ON o.user_id = u.id SET o.x = 1", "", "orders", "o", true, ""},
+		// the source table of INSERT ... SELECT.
+		{"INSERT INTO bar SELECT * FROM foo", "", "foo", "foo", false, ""},
+		{"REPLACE INTO bar SELECT o.* FROM orders o JOIN users u ON o.user_id = u.id", "", "orders", "o", true, ""},
+		{"INSERT INTO bar SELECT o.* FROM orders o JOIN users u ON o.user_id = u.id", "u", "users", "u", true, ""},
+		{"INSERT INTO bar (id) VALUES (1)", "", "", "", false,
+			"only 'INSERT ... SELECT' or 'REPLACE ... SELECT' without UNION can be split"},
+		// the table chosen by alias or name.
+		{"UPDATE orders o JOIN users u ON o.user_id = u.id SET o.x = u.y", "u", "users", "u", true, ""},
+		{"UPDATE orders o JOIN users u ON o.user_id = u.id SET o.x = u.y", "users", "users", "u", true, ""},
+		{"UPDATE db.orders JOIN users ON orders.user_id = users.id SET orders.x = 1", "db.orders", "db.orders", "db.orders", true, ""},
+		{"UPDATE `order` JOIN users ON `order`.user_id = users.id SET `order`.x = 1", "order", "`order`", "`order`", true, ""},
+		{"UPDATE orders o JOIN users u ON o.user_id = u.id SET o.x = u.y", "logs", "", "", true,
+			"table 'logs' is not found in the query"},
+		{"UPDATE users u1 JOIN users u2 ON u1.parent_id = u2.id SET u1.x = u2.x", "users", "", "", true,
+			"table 'users' is ambiguous in the query, use its alias"},
+	}
+	for _, c := range cases {
+		stmt, err := parseQuery(c.query)
+		assert.Nil(t, err, c.query)
+		ref, multi, err := getDrivingTable(stmt, c.splitTable)
+		if c.err != "" {
+			assert.EqualError(t, err, c.err, c.query)
+			continue
+		}
+		assert.Nil(t, err, c.query)
+		assert.Equal(t, c.table, sqlparser.String(ref.name), c.query)
+		assert.Equal(t, c.qualifier, sqlparser.String(ref.qualifier()), c.query)
+		assert.Equal(t, c.multi, multi, c.query)
+	}
+}
+
+func TestQualifiedRangeCondition(t *testing.T) {
+	stmt, err := parseQuery("UPDATE orders o JOIN users u ON o.user_id = u.id SET o.x = u.y WHERE u.active = 1")
+	assert.Nil(t, err)
+	sess := &Session{
+		SplittableColumn:  "id",
+		SplittableColumns: []string{"id"},
+		SplitMode:         SplitByRange,
+		SplitTable:        "o",
+		stmt:              stmt,
+		qualifier:         sqlparser.TableName{Name: sqlparser.NewTableIdent("o")},
+	}
+	tx := &Transaction{id: 1, rangeStart: []interface{}{int64(1)}, rangeEnd: []interface{}{int64(100)}}
+	sql, args := sess.getSplittedSQL(tx)
+	assert.Equal(t, "update orders as o join users as u on o.user_id = u.id set o.x = u.y "+
+		"where (u.active = 1) and (o.id between 1 and 100)", sql)
+	assert.Nil(t, args)
+
+	sess.SplittableColumn = "tenant_id,id"
+	sess.SplittableColumns = []string{"tenant_id", "id"}
+	sess.SplitMode = SplitByKeyset
+	tx = &Transaction{id: 2, rangeStart: []interface{}{int64(1), int64(10)}, rangeEnd: []interface{}{int64(2), int64(20)}}
+	assert.Equal(t, "(o.tenant_id, o.id) > (1, 10) and (o.tenant_id, o.id) <= (2, 20)", sess.getRangeDescription(tx))
+}
+
+func TestReverseTransactions(t *testing.T) {
+	transactions := []*Transaction{{id: 1}, {id: 2}, {id: 3}}
+	reverseTransactions(transactions)
+	assert.Equal(t, []int64{3, 2, 1}, []int64{transactions[0].id, transactions[1].id, transactions[2].id})
+}
+
+func TestCheckSplitColumn(t *testing.T) {
+	stubInfo := "CREATE TABLE `sent` (\n" +
+		"  `pk` varchar(10) NOT NULL,\n" +
+		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,\n" +
+		"  `user_id` int(10) unsigned DEFAULT NULL,\n" +
+		"  `status` tinyint NOT NULL,\n" +
+		"  `name` varchar(50) NOT NULL,\n" +
+		"  `location` point NOT NULL,\n" +
+		"  PRIMARY KEY (`pk`),\n" +
+		"  UNIQUE KEY `uk_id` (`id`),\n" +
+		"  KEY `idx_user_status` (`user_id`,`status`),\n" +
+		"  KEY `idx_name` (`name`),\n" +
+		"  SPATIAL KEY `idx_location` (`location`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8"
+
+	columnType, notNull, found := parseColumnInfo(stubInfo, "id")
+	assert.Equal(t, "bigint(20)", columnType)
+	assert.True(t, notNull)
+	assert.True(t, found)
+	columnType, notNull, found = parseColumnInfo(stubInfo, "USER_ID")
+	assert.Equal(t, "int(10)", columnType)
+	assert.False(t, notNull)
+	assert.True(t, found)
+	_, _, found = parseColumnInfo(stubInfo, "sent")
+	assert.False(t, found)
+
+	assert.True(t, isUnsignedColumn(stubInfo, "id"))
+	assert.True(t, isUnsignedColumn(stubInfo, "user_id"))
+	assert.False(t, isUnsignedColumn(stubInfo, "status"))
+	assert.False(t, isUnsignedColumn(stubInfo, "nothing"))
+
+	assert.True(t, isIndexedColumn(stubInfo, "pk"))
+	assert.True(t, isIndexedColumn(stubInfo, "id"))
+	assert.True(t, isIndexedColumn(stubInfo, "user_id"))
+	assert.False(t, isIndexedColumn(stubInfo, "status"))
+
+	columnName, err := checkSplitColumn(stubInfo, "ID")
+	assert.Nil(t, err)
+	assert.Equal(t, "id", columnName)
+	columnName, err = checkSplitColumn(stubInfo, "user_id")
+	assert.Nil(t, err)
+	assert.Equal(t, "user_id", columnName)
+
+	_, err = checkSplitColumn(stubInfo, "nothing")
+	assert.EqualError(t, err, "column not found")
+	_, err = checkSplitColumn(stubInfo, "name")
+	assert.EqualError(t, err, "column type 'varchar(50)' is not integer")
+	_, err = checkSplitColumn(stubInfo, "location")
+	assert.EqualError(t, err, "column type 'point' is not integer")
+	_, err = checkSplitColumn(stubInfo, "status")
+	assert.EqualError(t, err, "column is not the first column of any index")
+}